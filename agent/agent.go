@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+	"github.com/na-ga/gke-node-optimizer/log"
+)
+
+//
+const (
+	NoticePreempted   NoticeKind = "preempted"
+	NoticeMaintenance NoticeKind = "maintenance"
+)
+
+// metadata paths of the termination notices
+const (
+	pathPreempted        = "instance/preempted"
+	pathMaintenanceEvent = "instance/maintenance-event"
+)
+
+// maintenance events of the instance
+const (
+	maintenanceNone      = "NONE"
+	maintenanceMigrate   = "MIGRATE_ON_HOST_MAINTENANCE"
+	maintenanceTerminate = "TERMINATE_ON_HOST_MAINTENANCE"
+)
+
+// NoticeKind is the kind of the notice which terminates the node.
+type NoticeKind string
+
+// Notice is the notice of the termination of the node, given by the metadata server.
+type Notice struct {
+	Kind       NoticeKind
+	Value      string
+	ReceivedAt time.Time
+}
+
+// Option is the option of the agent.
+type Option struct {
+	// PollInterval is the interval of polling the metadata server.
+	PollInterval time.Duration
+	// DrainTimeout is the maximum time to drain the node after the notice, within the termination budget of the node.
+	DrainTimeout time.Duration
+}
+
+// Agent runs on each node, and drains the node by itself on the notice of the preemption or the termination by the maintenance.
+type Agent struct {
+	gkeClient gke.Client
+	metadata  *Metadata
+	nodeName  string
+	option    Option
+}
+
+// New returns the agent of the node.
+func New(gkeClient gke.Client, metadata *Metadata, nodeName string, option Option) *Agent {
+	return &Agent{
+		gkeClient: gkeClient,
+		metadata:  metadata,
+		nodeName:  nodeName,
+		option:    option,
+	}
+}
+
+// Run polls the metadata server until the notice is given, and drains the node within the drain timeout.
+// It returns the notice and the evictions after the drain, or the error of the context if canceled before the notice.
+func (a *Agent) Run(ctx context.Context) (*Notice, []*gke.Eviction, error) {
+	notice, err := a.WaitForNotice(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger := log.WithFields(log.Fields{log.FieldNode: a.nodeName})
+	logger.Warnf("Received %s notice (%s), draining node %s within %s", notice.Kind, notice.Value, a.nodeName, a.option.DrainTimeout)
+	// not canceled by the signal, since the agent itself is terminated with the node during the drain
+	drainCtx, cancel := context.WithTimeout(context.Background(), a.option.DrainTimeout)
+	defer cancel()
+	evictions, err := a.gkeClient.EvacuateNode(drainCtx, a.nodeName)
+	if err != nil {
+		return notice, evictions, fmt.Errorf("failed to drain node %s on %s notice: %s", a.nodeName, notice.Kind, err)
+	}
+	logger.Infof("Succeeded in drain node %s on %s notice in %s: pods=%d", a.nodeName, notice.Kind, time.Since(notice.ReceivedAt).Round(time.Millisecond), len(gke.EvictedPods(evictions)))
+	return notice, evictions, nil
+}
+
+// WaitForNotice polls the metadata server until the notice is given.
+// The errors of the metadata server are logged and retried, since the notice must not be missed by a transient error.
+func (a *Agent) WaitForNotice(ctx context.Context) (*Notice, error) {
+	logger := log.WithFields(log.Fields{log.FieldNode: a.nodeName})
+	logger.Infof("Watching termination notice of node %s every %s", a.nodeName, a.option.PollInterval)
+	ticker := time.NewTicker(a.option.PollInterval)
+	defer ticker.Stop()
+	lastMaintenance := maintenanceNone
+	for {
+		notice, maintenance, err := a.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Warnf("Failed to poll metadata server: %s", err)
+		}
+		if notice != nil {
+			return notice, nil
+		}
+		if maintenance != "" && maintenance != lastMaintenance {
+			if maintenance == maintenanceMigrate {
+				logger.Infof("Node %s is going to be live migrated, no drain required", a.nodeName)
+			}
+			lastMaintenance = maintenance
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll returns the notice if the node is preempted or going to be terminated by the maintenance, with the current maintenance event.
+func (a *Agent) poll(ctx context.Context) (*Notice, string, error) {
+	preempted, err := a.metadata.Get(ctx, pathPreempted)
+	if err != nil {
+		return nil, "", err
+	}
+	if preempted == "TRUE" {
+		return &Notice{Kind: NoticePreempted, Value: preempted, ReceivedAt: time.Now()}, "", nil
+	}
+	maintenance, err := a.metadata.Get(ctx, pathMaintenanceEvent)
+	if err != nil {
+		return nil, "", err
+	}
+	if maintenance == maintenanceTerminate {
+		return &Notice{Kind: NoticeMaintenance, Value: maintenance, ReceivedAt: time.Now()}, maintenance, nil
+	}
+	return nil, maintenance, nil
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultMetadataEndpoint is the endpoint of the metadata server on the GCE instance.
+const DefaultMetadataEndpoint = "http://metadata.google.internal"
+
+// MetadataTimeout is the timeout of a request to the metadata server.
+const MetadataTimeout = 5 * time.Second
+
+// Metadata is the client of the metadata server, whose endpoint can be replaced by the local stub.
+type Metadata struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// NewMetadata returns the client of the metadata server.
+func NewMetadata(endpoint string) *Metadata {
+	if endpoint == "" {
+		endpoint = DefaultMetadataEndpoint
+	}
+	return &Metadata{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: &http.Client{Timeout: MetadataTimeout},
+	}
+}
+
+// Get returns the value of the metadata of the path, such as `instance/preempted`.
+func (m *Metadata) Get(ctx context.Context, path string) (string, error) {
+	url := m.endpoint + "/computeMetadata/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	res, err := m.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %s", url, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response of %s: %s", url, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status of %s: %s", url, res.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/agent"
+	"github.com/na-ga/gke-node-optimizer/gke"
+	"github.com/na-ga/gke-node-optimizer/history"
+	"github.com/na-ga/gke-node-optimizer/log"
+	"github.com/na-ga/gke-node-optimizer/report"
+	"github.com/na-ga/gke-node-optimizer/service"
+	"github.com/na-ga/gke-node-optimizer/tracing"
+)
+
+const (
+	commandName    = "gke-node-optimizer"
+	defaultCommand = "run"
+	outputTable    = "table"
+	outputJSON     = "json"
+)
+
+type (
+	//
+	command struct {
+		usage          string
+		description    string
+		requireCluster bool
+		// output is the default output format, or empty not to output.
+		output string
+		flags  func(flags *flag.FlagSet, conf *configuration)
+		run    func(ctx context.Context, conf configuration, args []string) int
+	}
+)
+
+//
+var commands = map[string]*command{
+	"run": {
+		usage:          "run [flags]",
+		description:    "Refresh the oldest preemptible node and drain the on-demand node, which is the default command.",
+		requireCluster: true,
+		flags: func(flags *flag.FlagSet, conf *configuration) {
+			bindOptimizerFlags(flags, conf)
+			bindEvictionFlags(flags, conf)
+			bindDisruptionFlags(flags, conf)
+			flags.DurationVar(&conf.DaemonInterval, "daemon-interval", conf.DaemonInterval, "interval of runs, or 0 to run once (DAEMON_INTERVAL)")
+		},
+		run: runCommand,
+	},
+	"plan": {
+		usage:          "plan [flags]",
+		description:    "Show the refresh targets without refreshing them.",
+		requireCluster: true,
+		output:         outputTable,
+		flags: func(flags *flag.FlagSet, conf *configuration) {
+			bindOptimizerFlags(flags, conf)
+			bindDisruptionFlags(flags, conf)
+		},
+		run: planCommand,
+	},
+	"status": {
+		usage:          "status [flags]",
+		description:    "Show the node pools and the nodes of the cluster.",
+		requireCluster: true,
+		output:         outputTable,
+		run:            statusCommand,
+	},
+	"drain": {
+		usage:          "drain [flags] NODE",
+		description:    "Cordon and drain the node, and leave it cordoned.",
+		requireCluster: true,
+		output:         outputTable,
+		flags: func(flags *flag.FlagSet, conf *configuration) {
+			bindEvictionFlags(flags, conf)
+			bindDisruptionFlags(flags, conf)
+		},
+		run: drainCommand,
+	},
+	"refresh": {
+		usage:          "refresh [flags] NODE",
+		description:    "Drain the node, and delete it if preemptible.",
+		requireCluster: true,
+		output:         outputTable,
+		flags: func(flags *flag.FlagSet, conf *configuration) {
+			bindEvictionFlags(flags, conf)
+			bindDisruptionFlags(flags, conf)
+		},
+		run: refreshCommand,
+	},
+	"uncordon": {
+		usage:          "uncordon --all-managed [flags]",
+		description:    "Uncordon all nodes cordoned by the optimizer.",
+		requireCluster: true,
+		output:         outputTable,
+		flags: func(flags *flag.FlagSet, conf *configuration) {
+			flags.BoolVar(&conf.AllManaged, "all-managed", false, "uncordon all nodes cordoned by the optimizer")
+		},
+		run: uncordonCommand,
+	},
+	"agent": {
+		usage:       "agent --node NODE [flags]",
+		description: "Watch the termination notice of the node, and drain it by itself, which runs as a DaemonSet.",
+		output:      outputTable,
+		flags: func(flags *flag.FlagSet, conf *configuration) {
+			flags.StringVar(&conf.NodeName, "node", conf.NodeName, "name of the node where the agent runs (NODE_NAME)")
+			flags.StringVar(&conf.MetadataEndpoint, "metadata-endpoint", conf.MetadataEndpoint, "endpoint of the metadata server (METADATA_ENDPOINT)")
+			flags.DurationVar(&conf.AgentPollInterval, "poll-interval", conf.AgentPollInterval, "interval of polling the metadata server (AGENT_POLL_INTERVAL)")
+			flags.DurationVar(&conf.AgentDrainTimeout, "drain-timeout", conf.AgentDrainTimeout, "maximum time to drain the node after the notice (AGENT_DRAIN_TIMEOUT)")
+			bindEvictionFlags(flags, conf)
+		},
+		run: agentCommand,
+	},
+	"history": {
+		usage:       "history [flags]",
+		description: "Show the records and the trends of the run history.",
+		output:      outputTable,
+		run:         historyCommand,
+	},
+}
+
+// printUsage prints the list of the commands.
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", commandName)
+	for _, v := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", v, commands[v].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s [command] -h' for the flags of the command. The flags override the env vars.\n", commandName)
+}
+
+// bindCommonFlags binds the flags of all commands, whose defaults are the env vars.
+func bindCommonFlags(flags *flag.FlagSet, conf *configuration, output string) {
+	flags.StringVar(&conf.ProjectID, "project", conf.ProjectID, "project's ID (PROJECT_ID)")
+	flags.StringVar(&conf.ClusterName, "cluster", conf.ClusterName, "cluster's name (CLUSTER_NAME)")
+	flags.StringVar(&conf.ClusterLocation, "location", conf.ClusterLocation, "cluster's location (CLUSTER_LOCATION)")
+	flags.StringVar(&conf.LogLevel, "log-level", conf.LogLevel, "minimum level of the log output (LOG_LEVEL)")
+	flags.BoolVar(&conf.UseLocalKubeConfig, "local-kube-config", conf.UseLocalKubeConfig, "use local kube config (USE_LOCAL_KUBE_CONFIG)")
+	flags.StringVar(&conf.Output, "output", output, "output format, one of table or json, or empty not to output")
+}
+
+// bindOptimizerFlags binds the flags of the optimizer, whose defaults are the env vars.
+func bindOptimizerFlags(flags *flag.FlagSet, conf *configuration) {
+	flags.IntVar(&conf.MinimumPreemptibleNodeCount, "minimum-preemptible-node-count", conf.MinimumPreemptibleNodeCount, "expected minimum number of preemptible nodes (MINIMUM_PREEMPTIBLE_NODE_COUNT)")
+	flags.BoolVar(&conf.OptimizePreemptibleNode, "optimize-preemptible-node", conf.OptimizePreemptibleNode, "optimize the preemptible node (OPTIMIZE_PREEMPTIBLE_NODE)")
+	flags.BoolVar(&conf.OptimizeAutoscaleOndemandNode, "optimize-autoscale-ondemand-node", conf.OptimizeAutoscaleOndemandNode, "optimize the on-demand node (OPTIMIZE_AUTOSCALE_ONDEMAND_NODE)")
+	flags.IntVar(&conf.ConsolidationMaxNodes, "consolidation-max-nodes", conf.ConsolidationMaxNodes, "maximum number of underutilized on-demand nodes drained in a run, or 0 to drain the node with the fewest pods (CONSOLIDATION_MAX_NODES)")
+	flags.IntVar(&conf.ConsolidationThreshold, "consolidation-utilization-threshold", conf.ConsolidationThreshold, "percentage of requested cpu or memory under which the on-demand node is consolidated (CONSOLIDATION_UTILIZATION_THRESHOLD)")
+	flags.BoolVar(&conf.CheckPreemptibleCapacity, "check-preemptible-capacity", conf.CheckPreemptibleCapacity, "skip the drain of the on-demand node whose pods cannot be absorbed by the preemptible node pools (CHECK_PREEMPTIBLE_CAPACITY)")
+}
+
+// bindEvictionFlags binds the flags of the eviction, whose defaults are the env vars.
+func bindEvictionFlags(flags *flag.FlagSet, conf *configuration) {
+	flags.DurationVar(&conf.PodGracePeriod, "grace-period", conf.PodGracePeriod, "termination grace period of the evicted pods, or 0 to use the pods' own (POD_GRACE_PERIOD)")
+	flags.DurationVar(&conf.PodDeletionTimeout, "deletion-timeout", conf.PodDeletionTimeout, "maximum time to wait for the evicted pods to be deleted, or 0 not to wait (POD_DELETION_TIMEOUT)")
+	flags.StringVar(&conf.PreDrainTaint, "pre-drain-taint", conf.PreDrainTaint, "taint added to the nodes before the drain in the form of key[=value]:effect, or empty to disable (PRE_DRAIN_TAINT)")
+	flags.DurationVar(&conf.PreDrainPeriod, "pre-drain-period", conf.PreDrainPeriod, "time to wait after the pre-drain taint before the drain (PRE_DRAIN_PERIOD)")
+	flags.Func("force-delete-namespaces", "comma separated namespaces whose pods are deleted directly if the eviction is blocked or stuck (FORCE_DELETE_NAMESPACES)", func(s string) error {
+		conf.ForceDeleteNamespaces = strings.Split(s, ",")
+		return nil
+	})
+	flags.DurationVar(&conf.EvictionReadinessTimeout, "readiness-timeout", conf.EvictionReadinessTimeout, "maximum time to wait for the evicted pod of the stateful set or the restarted deployment to be ready, or 0 neither to wait for the stateful sets nor to restart the deployments (EVICTION_READINESS_TIMEOUT)")
+	flags.BoolVar(&conf.RestartSingleReplica, "restart-single-replica", conf.RestartSingleReplica, "restart the deployment which has only one replica with the surge instead of evicting its pod (RESTART_SINGLE_REPLICA_DEPLOYMENTS)")
+}
+
+// bindDisruptionFlags binds the flags of the disruption policy, whose defaults are the env vars.
+func bindDisruptionFlags(flags *flag.FlagSet, conf *configuration) {
+	flags.StringVar(&conf.DisruptionPolicy, "disruption-policy", conf.DisruptionPolicy, "policy of the nodes running the jobs or the pods not to be disrupted, one of evict, penalize, wait or skip (DISRUPTION_POLICY)")
+	flags.Func("disruption-namespace-policies", "comma separated policies by namespace in the form of namespace:policy (DISRUPTION_NAMESPACE_POLICIES)", func(s string) error {
+		conf.DisruptionNamespacePolicies = make(map[string]string)
+		for _, v := range strings.Split(s, ",") {
+			namespace, policy, ok := strings.Cut(v, ":")
+			if !ok {
+				return fmt.Errorf("invalid namespace policy: %s", v)
+			}
+			conf.DisruptionNamespacePolicies[namespace] = policy
+		}
+		return nil
+	})
+	flags.DurationVar(&conf.DisruptionWaitTimeout, "disruption-wait-timeout", conf.DisruptionWaitTimeout, "maximum time to wait for the protected pods to complete on each node by the wait policy (DISRUPTION_WAIT_TIMEOUT)")
+}
+
+// runCommand runs the optimizer once or periodically, and reports the results.
+func runCommand(ctx context.Context, conf configuration, _ []string) int {
+
+	//
+	store, err := newHistoryStore(ctx, conf)
+	if err != nil {
+		log.Errorf("Failed to create history store: %s", err)
+		return 1
+	}
+	reporter, err := newReporter(conf)
+	if err != nil {
+		log.Errorf("Failed to create reporter: %s", err)
+		return 1
+	}
+	estimator, err := newEstimator(conf)
+	if err != nil {
+		log.Errorf("Failed to load price table: %s", err)
+		return 1
+	}
+
+	//
+	if conf.OTLPEndpoint != "" {
+		shutdown, err := tracing.Init(ctx, conf.OTLPEndpoint, conf.OTLPInsecure)
+		if err != nil {
+			log.Errorf("Failed to initialize tracing: %s", err)
+			return 1
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownGracePeriod)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				log.Errorf("Failed to shutdown tracing: %s", err)
+			}
+		}()
+	}
+	hooks, err := newHookRunner(conf)
+	if err != nil {
+		log.Errorf("Failed to load hooks: %s", err)
+		return 1
+	}
+	gkeClient, err := newGKEClient(ctx, conf, conf.DaemonInterval > 0, hooks)
+	if err != nil {
+		log.Errorf("Failed to create gke client: %s", err)
+		if e := reporter.Report(newResult(conf).SetError(err).Finish()); e != nil {
+			log.Errorf("Failed to post error report: %s", e)
+		}
+		return 1
+	}
+
+	//
+	if conf.DaemonInterval <= 0 {
+		return optimize(ctx, conf, gkeClient, reporter, estimator, store, hooks)
+	}
+	log.Infof("Start gke node optimizer in daemon mode: interval=%s", conf.DaemonInterval)
+	ticker := time.NewTicker(conf.DaemonInterval)
+	defer ticker.Stop()
+	for {
+		optimize(ctx, conf, gkeClient, reporter, estimator, store, hooks) // continue even if failed
+		select {
+		case <-ctx.Done():
+			log.Infof("Stop gke node optimizer in daemon mode: %s", ctx.Err())
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// planCommand selects the refresh targets without refreshing them, reporting or recording them.
+func planCommand(ctx context.Context, conf configuration, _ []string) int {
+	gkeClient, err := newGKEClient(ctx, conf, false, nil)
+	if err != nil {
+		log.Errorf("Failed to create gke client: %s", err)
+		return 1
+	}
+	result := newResult(conf)
+	option := newOptimizerOption(conf)
+	option.DryRun = true
+	if err := service.NewOptimizer(gkeClient, result, option).Optimize(ctx); err != nil {
+		log.Errorf("Failed to plan: %s", err)
+		result.SetError(err)
+	}
+	printResult(conf.Output, result.Finish(), printPlan)
+	if result.Error != nil {
+		return 1
+	}
+	return 0
+}
+
+// statusCommand shows the node pools and the nodes of the cluster.
+func statusCommand(ctx context.Context, conf configuration, _ []string) int {
+	gkeClient, err := newGKEClient(ctx, conf, false, nil)
+	if err != nil {
+		log.Errorf("Failed to create gke client: %s", err)
+		return 1
+	}
+	result := newResult(conf)
+	cluster, err := gkeClient.GetCluster(ctx)
+	if err != nil {
+		log.Errorf("Failed to get cluster: %s", err)
+		return 1
+	}
+	nodes, err := gkeClient.GetNodeList(ctx)
+	if err != nil {
+		log.Errorf("Failed to get node list: %s", err)
+		return 1
+	}
+	result.Cluster = cluster
+	result.ActiveNodePools = cluster.NodePool
+	result.ActiveNodes = nodes
+	for _, v := range nodes {
+		if v.Preemptible {
+			result.PreemptibleNodeActualCount++
+		}
+	}
+	printResult(conf.Output, result.Finish(), printStatus)
+	return 0
+}
+
+// drainCommand cordons and drains the node by the same logic as the optimizer.
+func drainCommand(ctx context.Context, conf configuration, args []string) int {
+	return nodeCommand(ctx, conf, args, "drain", func(gkeClient gke.Client, nodeName string) ([]*gke.Eviction, error) {
+		return gkeClient.DrainNode(ctx, nodeName)
+	})
+}
+
+// refreshCommand refreshes the node by the same logic as the optimizer.
+func refreshCommand(ctx context.Context, conf configuration, args []string) int {
+	return nodeCommand(ctx, conf, args, "refresh", func(gkeClient gke.Client, nodeName string) ([]*gke.Eviction, error) {
+		return gkeClient.RefreshNode(ctx, nodeName)
+	})
+}
+
+// nodeCommand runs the action to the node given by the argument, and shows the evicted pods.
+func nodeCommand(ctx context.Context, conf configuration, args []string, action string, fn func(gkeClient gke.Client, nodeName string) ([]*gke.Eviction, error)) int {
+	if len(args) != 1 {
+		log.Errorf("Node name is required: %s %s NODE", commandName, action)
+		return 2
+	}
+	hooks, err := newHookRunner(conf)
+	if err != nil {
+		log.Errorf("Failed to load hooks: %s", err)
+		return 1
+	}
+	gkeClient, err := newGKEClient(ctx, conf, false, hooks)
+	if err != nil {
+		log.Errorf("Failed to create gke client: %s", err)
+		return 1
+	}
+	result := newResult(conf)
+	if hooks != nil {
+		hooks.Begin(result.RunID())
+	}
+	result.Evictions, err = fn(gkeClient, args[0])
+	result.EvictedPods = gke.EvictedPods(result.Evictions)
+	if hooks != nil {
+		result.HookResults = hooks.Results()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{log.FieldNode: args[0]}).Errorf("Failed to %s node: %s", action, err)
+		result.SetError(err)
+	}
+	printResult(conf.Output, result.Finish(), printEvictedPods)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// agentCommand drains the node by itself on the termination notice, and waits for the termination not to drain it again.
+func agentCommand(ctx context.Context, conf configuration, _ []string) int {
+	if conf.NodeName == "" {
+		log.Errorf("NODE_NAME or --node is required: %s agent --node NODE", commandName)
+		return 2
+	}
+	metadata := agent.NewMetadata(conf.MetadataEndpoint)
+	if err := fillClusterByMetadata(ctx, &conf, metadata); err != nil {
+		log.Errorf("Failed to get cluster from metadata server: %s", err)
+		return 1
+	}
+	hooks, err := newHookRunner(conf)
+	if err != nil {
+		log.Errorf("Failed to load hooks: %s", err)
+		return 1
+	}
+	gkeClient, err := newGKEClient(ctx, conf, false, hooks)
+	if err != nil {
+		log.Errorf("Failed to create gke client: %s", err)
+		return 1
+	}
+	result := newResult(conf)
+	if hooks != nil {
+		hooks.Begin(result.RunID())
+	}
+	notice, evictions, err := agent.New(gkeClient, metadata, conf.NodeName, agent.Option{
+		PollInterval: conf.AgentPollInterval,
+		DrainTimeout: conf.AgentDrainTimeout,
+	}).Run(ctx)
+	if notice == nil {
+		log.Infof("Stopped agent of node %s before termination notice", conf.NodeName)
+		return 0
+	}
+	result.Evictions = evictions
+	result.EvictedPods = gke.EvictedPods(evictions)
+	if hooks != nil {
+		result.HookResults = hooks.Results()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{log.FieldNode: conf.NodeName}).Errorf("Failed to drain node on termination notice: %s", err)
+		result.SetError(err)
+	}
+	printResult(conf.Output, result.Finish(), printEvictedPods)
+	<-ctx.Done()
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// fillClusterByMetadata sets the project and the cluster of the node from the metadata server if not specified.
+func fillClusterByMetadata(ctx context.Context, conf *configuration, metadata *agent.Metadata) error {
+	for _, v := range []struct {
+		value *string
+		path  string
+	}{
+		{&conf.ProjectID, "project/project-id"},
+		{&conf.ClusterName, "instance/attributes/cluster-name"},
+		{&conf.ClusterLocation, "instance/attributes/cluster-location"},
+	} {
+		if *v.value != "" {
+			continue
+		}
+		value, err := metadata.Get(ctx, v.path)
+		if err != nil {
+			return err
+		}
+		*v.value = value
+	}
+	return nil
+}
+
+// uncordonCommand uncordons all nodes cordoned by the optimizer.
+func uncordonCommand(ctx context.Context, conf configuration, _ []string) int {
+	if !conf.AllManaged {
+		log.Errorf("Only --all-managed is supported: %s uncordon --all-managed", commandName)
+		return 2
+	}
+	gkeClient, err := newGKEClient(ctx, conf, false, nil)
+	if err != nil {
+		log.Errorf("Failed to create gke client: %s", err)
+		return 1
+	}
+	nodeNames, err := gkeClient.UncordonManagedNodes(ctx)
+	if err != nil {
+		log.Errorf("Failed to uncordon managed nodes: %s", err)
+	}
+	switch conf.Output {
+	case outputJSON:
+		printJSON(os.Stdout, struct {
+			UncordonedNodes []string `json:"uncordoned_nodes"`
+		}{nodeNames})
+	case outputTable:
+		printTable(os.Stdout, func(w io.Writer) {
+			fmt.Fprintln(w, "UNCORDONED NODE")
+			for _, v := range nodeNames {
+				fmt.Fprintln(w, v)
+			}
+		})
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// historyCommand shows the records and the trends of the run history.
+func historyCommand(ctx context.Context, conf configuration, _ []string) int {
+	store, err := newHistoryStore(ctx, conf)
+	if err != nil {
+		log.Errorf("Failed to create history store: %s", err)
+		return 1
+	}
+	if store == nil {
+		log.Error("History store is not configured")
+		return 1
+	}
+	records, err := store.List(ctx)
+	if err != nil {
+		log.Errorf("Failed to list history: %s", err)
+		return 1
+	}
+	trend := history.NewTrend(records)
+	switch conf.Output {
+	case outputJSON:
+		printJSON(os.Stdout, struct {
+			Records []*history.Record `json:"records"`
+			Trend   *report.Trend     `json:"trend"`
+		}{records, trend})
+	case outputTable:
+		printTable(os.Stdout, func(w io.Writer) {
+			fmt.Fprintln(w, "START TIME\tRUN ID\tSEVERITY\tNODES\tON-DEMAND\tREFRESHED\tAGE\tEVICTED\tMESSAGE")
+			for _, v := range records {
+				message := v.Error
+				if message == "" && v.DeferredReason != "" {
+					message = "deferred: " + v.DeferredReason
+				}
+				age := "-"
+				if v.RefreshedNode != "" {
+					age = (time.Duration(v.RefreshedNodeAgeSeconds) * time.Second).String()
+				}
+				refreshed := strings.Trim(strings.Join([]string{v.RefreshedNode, v.DrainedOndemandNode}, ","), ",")
+				if refreshed == "" {
+					refreshed = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%d\t%s\n",
+					v.StartTime.Format(time.RFC3339), v.RunID, v.Severity, v.NodeCount, v.OndemandNodeCount, refreshed, age, v.EvictedPodCount, message)
+			}
+		})
+		min, avg, max := trend.OndemandNodeCountRange()
+		fmt.Printf("\nruns=%d, successRate=%.1f%%, averageNodeAgeAtRefresh=%s, ondemandNodes=min:%d/avg:%.1f/max:%d\n",
+			trend.Runs, trend.SuccessRate()*100, trend.AverageRefreshedNodeAge, min, avg, max)
+		for _, v := range trend.RecurringFailures {
+			fmt.Printf("recurring failure: count=%d, last=%s, message=%s\n", v.Count, v.LastTime.Format(time.RFC3339), v.Message)
+		}
+	}
+	return 0
+}
+
+// printResult prints the result as the JSON report, or as the table by the function.
+func printResult(output string, result *report.Result, table func(w io.Writer, result *report.Result)) {
+	switch output {
+	case outputJSON:
+		if err := report.Render(os.Stdout, report.FormatJSON, result); err != nil {
+			log.Errorf("Failed to print result: %s", err)
+		}
+	case outputTable:
+		printTable(os.Stdout, func(w io.Writer) {
+			table(w, result)
+		})
+	}
+}
+
+// printSummary prints the summary of the run.
+func printSummary(w io.Writer, result *report.Result) {
+	fmt.Fprintln(w, "RUN ID\tSEVERITY\tMESSAGE")
+	message := summaryMessage(result)
+	if result.Error != nil {
+		message = result.Error.Error()
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\n", result.RunID(), result.Severity(), message)
+}
+
+// printPlan prints the refresh targets.
+func printPlan(w io.Writer, result *report.Result) {
+	fmt.Fprintln(w, "TARGET\tNODE\tPOOL\tZONE\tAGE\tPODS")
+	target := func(kind string, node *gke.Node) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", kind, node.Name, node.NodePool, node.Zone, node.Age.Round(time.Minute), len(node.Pods))
+	}
+	if result.TargetPreemptibleNode != nil {
+		target("preemptible", result.TargetPreemptibleNode)
+	}
+	for _, v := range result.GetTargetOndemandAutoscaleNodes() {
+		target("ondemand-autoscale", v)
+	}
+	if c := result.Consolidation; c != nil && len(c.Skipped) > 0 {
+		fmt.Fprintln(w, "\nSKIPPED\tCPU\tMEMORY\tREASON")
+		for _, v := range c.Skipped {
+			fmt.Fprintf(w, "%s\t%d%%\t%d%%\t%s\n", v.Node.Name, v.CPUUtilization, v.MemoryUtilization, v.Reason)
+		}
+	}
+	if len(result.ProtectedNodes) > 0 {
+		fmt.Fprintln(w, "\nPROTECTED\tPOLICY\tPODS")
+		for _, v := range result.ProtectedNodes {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", v.Node.Name, v.Policy, len(v.Pods))
+		}
+	}
+	switch {
+	case result.Error != nil:
+		fmt.Fprintf(w, "\nerror: %s\n", result.Error)
+	case result.DeferredReason != "":
+		fmt.Fprintf(w, "\ndeferred: %s\n", result.DeferredReason)
+	}
+}
+
+// printStatus prints the node pools and the nodes like the slack report.
+func printStatus(w io.Writer, result *report.Result) {
+	fmt.Fprintln(w, "NODE POOL\tPREEMPTIBLE\tAUTOSCALE\tMIN\tMAX\tSTATUS")
+	for _, v := range result.ActiveNodePools {
+		fmt.Fprintf(w, "%s\t%t\t%t\t%d\t%d\t%s\n", v.Name, v.Preemptible, v.Autoscale, v.MinNodeCount, v.MaxNodeCount, v.Status)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "NODE\tPOOL\tZONE\tREADY\tPREEMPTIBLE\tAGE\tPODS")
+	for _, v := range result.ActiveNodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%s\t%d\n", v.Name, v.NodePool, v.Zone, v.Ready, v.Preemptible, v.Age.Round(time.Minute), len(v.Pods))
+	}
+}
+
+// printEvictedPods prints the outcomes of the eviction of the pods.
+func printEvictedPods(w io.Writer, result *report.Result) {
+	fmt.Fprintln(w, "POD\tNAMESPACE\tWORKLOAD\tNODE\tOUTCOME\tATTEMPTS")
+	for _, v := range result.Evictions {
+		kind, name := v.Pod.WorkloadName()
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\t%s\t%d\n", v.Pod.Name, v.Pod.Namespace, kind, name, v.Pod.NodeName, v.Outcome, v.Attempts)
+	}
+	if len(result.HookResults) > 0 {
+		fmt.Fprintln(w, "\nHOOK\tPHASE\tMODE\tDURATION\tERROR")
+		for _, v := range result.HookResults {
+			message := ""
+			if v.Err != nil {
+				message = v.Err.Error()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", v.Name, v.Phase, v.Mode, v.Duration.Round(time.Millisecond), message)
+		}
+	}
+	if result.Error != nil {
+		fmt.Fprintf(w, "\nerror: %s\n", result.Error)
+	}
+}
+
+//
+func printTable(out io.Writer, fn func(w io.Writer)) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fn(w)
+	if err := w.Flush(); err != nil {
+		log.Errorf("Failed to print table: %s", err)
+	}
+}
+
+//
+func printJSON(out io.Writer, v interface{}) {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Errorf("Failed to print json: %s", err)
+	}
+}
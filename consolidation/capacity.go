@@ -0,0 +1,74 @@
+package consolidation
+
+import (
+	"fmt"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+// Capacity is the free capacity of the preemptible node pools, which absorbs the pods of the drained on-demand nodes.
+// It consists of the free allocatable of the running nodes, and the new nodes up to the maximum node count of the autoscaled pools.
+type Capacity struct {
+	free  map[string]gke.Resources
+	nodes map[string]*gke.Node
+}
+
+// NewCapacity returns the capacity of the node pools by the ready nodes of each pool, except the excluded nodes which are drained by others.
+// The room to scale up is limited by the count of all nodes of each pool including the not ready nodes, since they also count toward the maximum.
+// The new node of the pool is simulated by the allocatable of the running node of the pool, so the pool without nodes cannot scale up in the simulation.
+func NewCapacity(nodePools []*gke.NodePool, nodesByPool map[string][]*gke.Node, nodeCountByPool map[string]int, excluded []string) *Capacity {
+	drained := make(map[string]bool, len(excluded))
+	for _, v := range excluded {
+		drained[v] = true
+	}
+	c := &Capacity{
+		free:  make(map[string]gke.Resources),
+		nodes: make(map[string]*gke.Node),
+	}
+	for _, pool := range nodePools {
+		var template *gke.Node
+		for _, v := range nodesByPool[pool.Name] {
+			if template == nil && v.Allocatable.Pods > 0 {
+				template = v
+			}
+			if v.Ready && !drained[v.Name] && v.Allocatable.Pods > 0 {
+				c.free[v.Name] = v.Allocatable.Sub(v.RequestedResources())
+				c.nodes[v.Name] = v
+			}
+		}
+		if !pool.Autoscale || template == nil {
+			continue
+		}
+		room := pool.MaxNodeCount*len(pool.InstanceGroupURLs) - nodeCountByPool[pool.Name]
+		for i := 0; i < room; i++ {
+			node := newNodeLike(template, fmt.Sprintf("%s/scale-up-%d", pool.Name, i+1))
+			c.free[node.Name] = node.Allocatable.Sub(node.RequestedResources())
+			c.nodes[node.Name] = node
+		}
+	}
+	return c
+}
+
+// Absorb places the movable pods of the node into the capacity, and keeps the capacity used by them if all pods fit.
+// It returns the node names where the pods are placed by the pod name, where the new nodes are named `{pool}/scale-up-{n}`.
+func (c *Capacity) Absorb(node *gke.Node) (map[string]string, error) {
+	destinations, next, err := place(node, c.free, c.nodes, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.free = next
+	return destinations, nil
+}
+
+// newNodeLike returns the empty node which has the same allocatable, labels and taints as the template, with the DaemonSet pods.
+func newNodeLike(template *gke.Node, name string) *gke.Node {
+	node := *template
+	node.Name = name
+	node.Pods = make([]*gke.Pod, 0, len(template.Pods))
+	for _, v := range template.Pods {
+		if v.OwnerKind == "DaemonSet" {
+			node.Pods = append(node.Pods, v)
+		}
+	}
+	return &node
+}
@@ -0,0 +1,209 @@
+package consolidation
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+// Option is the option of the consolidation of the on-demand nodes.
+type Option struct {
+	// MaxNodes is the maximum number of the nodes drained in a run. The consolidation is disabled if 0.
+	MaxNodes int
+	// UtilizationThreshold is the percentage of the requested CPU or memory of the allocatable, under which the node is a candidate.
+	UtilizationThreshold int
+}
+
+// Plan is the result of the simulation of the consolidation.
+type Plan struct {
+	// Targets is the nodes to be drained, whose pods fit into the other nodes.
+	Targets []*Candidate
+	// Skipped is the underutilized nodes which are not drained, with the reason.
+	Skipped []*Candidate
+}
+
+// Candidate is the underutilized node.
+type Candidate struct {
+	Node              *gke.Node
+	Requested         gke.Resources
+	CPUUtilization    int
+	MemoryUtilization int
+	// Destinations is the node names where the movable pods are placed in the simulation, by the pod name.
+	Destinations map[string]string
+	// Reason is why the node is skipped.
+	Reason string
+}
+
+// Utilization returns the larger of the CPU and the memory utilization.
+func (c *Candidate) Utilization() int {
+	if c.CPUUtilization > c.MemoryUtilization {
+		return c.CPUUtilization
+	}
+	return c.MemoryUtilization
+}
+
+// TargetNodes returns the nodes to be drained.
+func (p *Plan) TargetNodes() []*gke.Node {
+	ret := make([]*gke.Node, 0, len(p.Targets))
+	for _, v := range p.Targets {
+		ret = append(ret, v.Node)
+	}
+	return ret
+}
+
+// Skip moves the target to the skipped with the reason.
+func (p *Plan) Skip(nodeName, reason string) {
+	for i, v := range p.Targets {
+		if v.Node.Name == nodeName {
+			v.Reason = reason
+			p.Targets = append(p.Targets[:i], p.Targets[i+1:]...)
+			p.Skipped = append(p.Skipped, v)
+			return
+		}
+	}
+}
+
+// Planner selects the on-demand nodes whose pods can be bin-packed into the other nodes, in the style of the descheduler.
+type Planner struct {
+	option Option
+}
+
+// NewPlanner returns the planner.
+func NewPlanner(option Option) *Planner {
+	return &Planner{option: option}
+}
+
+// Plan selects up to MaxNodes candidates in the ascending order of the utilization.
+// The pods of each candidate are placed into the free capacity of the other nodes, except the excluded nodes which are drained by others,
+// and the capacity used by the placement is kept for the later candidates. The node which receives the pods is not drained.
+// The requested CPU, memory and the number of pods are simulated with the taints, the node selector and the required node affinity.
+func (p *Planner) Plan(candidates []*gke.Node, nodes []*gke.Node, excluded []string) *Plan {
+	plan := &Plan{}
+	drained := make(map[string]bool, len(excluded)+p.option.MaxNodes)
+	for _, v := range excluded {
+		drained[v] = true
+	}
+	free := make(map[string]gke.Resources, len(nodes))
+	nodesByName := make(map[string]*gke.Node, len(nodes))
+	for _, v := range nodes {
+		if v.Ready && !drained[v.Name] && v.Allocatable.Pods > 0 {
+			free[v.Name] = v.Allocatable.Sub(v.RequestedResources())
+			nodesByName[v.Name] = v
+		}
+	}
+
+	// find underutilized nodes
+	underutilized := make([]*Candidate, 0, len(candidates))
+	for _, v := range candidates {
+		if drained[v.Name] || v.Allocatable.MilliCPU <= 0 || v.Allocatable.Memory <= 0 {
+			continue
+		}
+		c := &Candidate{Node: v, Requested: v.RequestedResources()}
+		c.CPUUtilization = int(c.Requested.MilliCPU * 100 / v.Allocatable.MilliCPU)
+		c.MemoryUtilization = int(c.Requested.Memory * 100 / v.Allocatable.Memory)
+		if c.Utilization() < p.option.UtilizationThreshold {
+			underutilized = append(underutilized, c)
+		}
+	}
+	sort.SliceStable(underutilized, func(i, j int) bool {
+		return underutilized[i].Utilization() < underutilized[j].Utilization()
+	})
+
+	// simulate
+	pending := make(map[string]bool, len(underutilized))
+	for _, c := range underutilized {
+		pending[c.Node.Name] = true
+	}
+	received := make(map[string]bool, len(nodes))
+	for _, c := range underutilized {
+		switch {
+		case len(plan.Targets) >= p.option.MaxNodes:
+			c.Reason = fmt.Sprintf("reached maximum nodes %d", p.option.MaxNodes)
+		case received[c.Node.Name]:
+			c.Reason = "receives pods of other target"
+		}
+		delete(pending, c.Node.Name)
+		if c.Reason != "" {
+			plan.Skipped = append(plan.Skipped, c)
+			continue
+		}
+		destinations, next, err := place(c.Node, free, nodesByName, pending)
+		if err != nil {
+			c.Reason = err.Error()
+			plan.Skipped = append(plan.Skipped, c)
+			continue
+		}
+		c.Destinations = destinations
+		free = next
+		delete(free, c.Node.Name)
+		for _, v := range destinations {
+			received[v] = true
+		}
+		plan.Targets = append(plan.Targets, c)
+	}
+	return plan
+}
+
+// PlanWithFallback plans the preferred candidates, and plans the penalized candidates only if no preferred candidate is the target.
+// The skipped preferred candidates are kept in the plan of the penalized candidates.
+func (p *Planner) PlanWithFallback(preferred, penalized []*gke.Node, nodes []*gke.Node, excluded []string) *Plan {
+	plan := p.Plan(preferred, nodes, excluded)
+	if len(plan.Targets) > 0 || len(penalized) == 0 {
+		return plan
+	}
+	fallback := p.Plan(penalized, nodes, excluded)
+	fallback.Skipped = append(plan.Skipped, fallback.Skipped...)
+	return fallback
+}
+
+// place places the movable pods of the node into the other nodes by the first fit decreasing,
+// and returns the destinations and the free capacity after the placement.
+// The nodes are filled from the busiest one, and the pending candidates are used last not to block their consolidation.
+func place(node *gke.Node, free map[string]gke.Resources, nodes map[string]*gke.Node, pending map[string]bool) (map[string]string, map[string]gke.Resources, error) {
+	next := make(map[string]gke.Resources, len(free))
+	names := make([]string, 0, len(free))
+	for k, v := range free {
+		next[k] = v
+		if k != node.Name {
+			names = append(names, k)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pending[names[i]] != pending[names[j]] {
+			return !pending[names[i]]
+		}
+		if free[names[i]].MilliCPU != free[names[j]].MilliCPU {
+			return free[names[i]].MilliCPU < free[names[j]].MilliCPU
+		}
+		return names[i] < names[j]
+	})
+	pods := make([]*gke.Pod, 0, len(node.Pods))
+	for _, v := range node.Pods {
+		if v.IsMovable() {
+			pods = append(pods, v)
+		}
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		if pods[i].Requests.MilliCPU != pods[j].Requests.MilliCPU {
+			return pods[i].Requests.MilliCPU > pods[j].Requests.MilliCPU
+		}
+		return pods[i].Requests.Memory > pods[j].Requests.Memory
+	})
+	destinations := make(map[string]string, len(pods))
+	for _, pod := range pods {
+		placed := false
+		for _, name := range names {
+			if pod.Requests.Fits(next[name]) && pod.CanScheduleOn(nodes[name]) {
+				next[name] = next[name].Sub(pod.Requests)
+				destinations[pod.Name] = name
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return nil, nil, fmt.Errorf("no node can schedule pod %s/%s (cpu=%dm, memory=%d)", pod.Namespace, pod.Name, pod.Requests.MilliCPU, pod.Requests.Memory)
+		}
+	}
+	return destinations, next, nil
+}
@@ -0,0 +1,193 @@
+package consolidation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+const gib = 1 << 30
+
+func testNode(name string, milliCPU int64, pods ...*gke.Pod) *gke.Node {
+	return &gke.Node{
+		Name:        name,
+		Ready:       true,
+		Allocatable: gke.Resources{MilliCPU: milliCPU, Memory: 16 * gib, Pods: 110},
+		Pods:        pods,
+	}
+}
+
+func testPod(name string, milliCPU int64) *gke.Pod {
+	return &gke.Pod{
+		Name:      name,
+		Namespace: "default",
+		OwnerKind: "Deployment",
+		Requests:  gke.Resources{MilliCPU: milliCPU, Memory: gib, Pods: 1},
+	}
+}
+
+func candidateNames(candidates []*Candidate) []string {
+	ret := make([]string, 0, len(candidates))
+	for _, v := range candidates {
+		ret = append(ret, v.Node.Name)
+	}
+	return ret
+}
+
+func TestPlannerPlan(t *testing.T) {
+	a := testNode("a", 4000, testPod("a-1", 1200))             // 30%
+	b := testNode("b", 4000, testPod("b-1", 400))              // 10%
+	c := testNode("c", 4000, testPod("c-1", 2400))             // 60%
+	busy := testNode("busy", 8000, testPod("busy-1", 4000))    // 50%
+	small := testNode("small", 4000, testPod("small-1", 100))  // 2%
+	large := testNode("large", 4000, testPod("large-1", 3000)) // 75%
+	daemon := testNode("daemon", 4000, &gke.Pod{Name: "daemon-1", OwnerKind: "DaemonSet", Requests: gke.Resources{MilliCPU: 200, Memory: gib, Pods: 1}})
+	tests := []struct {
+		name         string
+		option       Option
+		candidates   []*gke.Node
+		nodes        []*gke.Node
+		excluded     []string
+		targets      []string
+		skipped      []string
+		destinations map[string]string
+	}{
+		{
+			name:       "ascending utilization under threshold",
+			option:     Option{MaxNodes: 3, UtilizationThreshold: 50},
+			candidates: []*gke.Node{a, b, c},
+			nodes:      []*gke.Node{a, b, c, busy},
+			targets:    []string{"b", "a"},
+		},
+		{
+			name:       "maximum nodes",
+			option:     Option{MaxNodes: 1, UtilizationThreshold: 50},
+			candidates: []*gke.Node{a, small},
+			nodes:      []*gke.Node{a, small, busy},
+			targets:    []string{"small"},
+			skipped:    []string{"a"},
+		},
+		{
+			name:       "node receiving pods is not drained",
+			option:     Option{MaxNodes: 2, UtilizationThreshold: 50},
+			candidates: []*gke.Node{a, b},
+			nodes:      []*gke.Node{a, b},
+			targets:    []string{"b"},
+			skipped:    []string{"a"},
+		},
+		{
+			name:         "first fit decreasing",
+			option:       Option{MaxNodes: 1, UtilizationThreshold: 60},
+			candidates:   []*gke.Node{testNode("d", 4000, testPod("d-1", 500), testPod("d-2", 1500))},
+			nodes:        []*gke.Node{testNode("e", 4000, testPod("e-1", 2400)), testNode("f", 4000, testPod("f-1", 2000))},
+			targets:      []string{"d"},
+			destinations: map[string]string{"d-2": "e", "d-1": "f"},
+		},
+		{
+			name:       "daemon set pods stay",
+			option:     Option{MaxNodes: 1, UtilizationThreshold: 50},
+			candidates: []*gke.Node{daemon},
+			nodes:      []*gke.Node{daemon, large},
+			targets:    []string{"daemon"},
+		},
+		{
+			name:       "excluded nodes are neither candidates nor destinations",
+			option:     Option{MaxNodes: 2, UtilizationThreshold: 50},
+			candidates: []*gke.Node{a, b},
+			nodes:      []*gke.Node{a, b, busy},
+			excluded:   []string{"b", "busy"},
+			skipped:    []string{"a"},
+		},
+		{
+			name:       "pods do not fit",
+			option:     Option{MaxNodes: 1, UtilizationThreshold: 50},
+			candidates: []*gke.Node{a},
+			nodes:      []*gke.Node{a, large},
+			skipped:    []string{"a"},
+		},
+		{
+			name:       "disabled",
+			option:     Option{MaxNodes: 0, UtilizationThreshold: 50},
+			candidates: []*gke.Node{b},
+			nodes:      []*gke.Node{b, busy},
+			skipped:    []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := NewPlanner(tt.option).Plan(tt.candidates, tt.nodes, tt.excluded)
+			if got := candidateNames(plan.Targets); !reflect.DeepEqual(got, append([]string{}, tt.targets...)) {
+				t.Errorf("unexpected targets: got=%v, want=%v", got, tt.targets)
+			}
+			if got := candidateNames(plan.Skipped); !reflect.DeepEqual(got, append([]string{}, tt.skipped...)) {
+				t.Errorf("unexpected skipped: got=%v, want=%v", got, tt.skipped)
+			}
+			for _, v := range plan.Skipped {
+				if v.Reason == "" {
+					t.Errorf("skipped node %s has no reason", v.Node.Name)
+				}
+			}
+			if tt.destinations != nil && len(plan.Targets) > 0 && !reflect.DeepEqual(plan.Targets[0].Destinations, tt.destinations) {
+				t.Errorf("unexpected destinations: got=%v, want=%v", plan.Targets[0].Destinations, tt.destinations)
+			}
+		})
+	}
+}
+
+func TestPlannerPlanWithFallback(t *testing.T) {
+	preferred := testNode("preferred", 4000, testPod("preferred-1", 400))
+	penalized := testNode("penalized", 4000, testPod("penalized-1", 400))
+	unschedulable := testNode("unschedulable", 4000, testPod("unschedulable-1", 400))
+	unschedulable.Pods[0].NodeSelector = map[string]string{"pool": "none"}
+	large := testNode("large", 4000, testPod("large-1", 3000))
+	busy := testNode("busy", 8000, testPod("busy-1", 4000))
+	tests := []struct {
+		name      string
+		preferred []*gke.Node
+		penalized []*gke.Node
+		nodes     []*gke.Node
+		targets   []string
+		skipped   []string
+	}{
+		{
+			name:      "preferred nodes first",
+			preferred: []*gke.Node{preferred},
+			penalized: []*gke.Node{penalized},
+			nodes:     []*gke.Node{preferred, penalized, busy},
+			targets:   []string{"preferred"},
+		},
+		{
+			name:      "penalized nodes if preferred nodes yield no target",
+			preferred: []*gke.Node{large},
+			penalized: []*gke.Node{penalized},
+			nodes:     []*gke.Node{large, penalized, busy},
+			targets:   []string{"penalized"},
+		},
+		{
+			name:      "skipped preferred nodes are kept",
+			preferred: []*gke.Node{unschedulable},
+			penalized: []*gke.Node{penalized},
+			nodes:     []*gke.Node{unschedulable, penalized, large},
+			targets:   []string{"penalized"},
+			skipped:   []string{"unschedulable"},
+		},
+		{
+			name:      "no penalized nodes",
+			preferred: []*gke.Node{unschedulable},
+			nodes:     []*gke.Node{unschedulable, large},
+			skipped:   []string{"unschedulable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := NewPlanner(Option{MaxNodes: 1, UtilizationThreshold: 50}).PlanWithFallback(tt.preferred, tt.penalized, tt.nodes, nil)
+			if got := candidateNames(plan.Targets); !reflect.DeepEqual(got, append([]string{}, tt.targets...)) {
+				t.Errorf("unexpected targets: got=%v, want=%v", got, tt.targets)
+			}
+			if got := candidateNames(plan.Skipped); !reflect.DeepEqual(got, append([]string{}, tt.skipped...)) {
+				t.Errorf("unexpected skipped: got=%v, want=%v", got, tt.skipped)
+			}
+		})
+	}
+}
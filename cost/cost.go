@@ -0,0 +1,138 @@
+package cost
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+// Estimate is the estimated savings of a run and the cumulative savings of all runs.
+type Estimate struct {
+	Currency string
+	// Period is the duration which the savings of a run lasts, such as the interval of runs.
+	Period time.Duration
+	// PreemptibleSavingsPerHour is the difference from the on-demand price of the running preemptible nodes.
+	PreemptibleSavingsPerHour float64
+	// OndemandSavingsPerHour is the on-demand price of the drained on-demand nodes, assuming they are scaled down.
+	OndemandSavingsPerHour float64
+	// Savings is the estimated savings of the run over the period.
+	Savings float64
+	// CumulativeSavings is the total savings of all runs since CumulativeSince.
+	CumulativeSavings float64
+	CumulativeRuns    int
+	CumulativeSince   time.Time
+	// UnknownMachineTypes is the machine types which are not in the price table, and not included in the estimate.
+	UnknownMachineTypes []string
+}
+
+// Estimator estimates the savings by the price table, and accumulates them into the ledger.
+type Estimator struct {
+	prices     *PriceTable
+	period     time.Duration
+	ledgerPath string
+	ledger     ledger
+}
+
+//
+type ledger struct {
+	Currency string    `json:"currency"`
+	Runs     int       `json:"runs"`
+	Savings  float64   `json:"savings"`
+	Since    time.Time `json:"since"`
+}
+
+// NewEstimator returns the estimator.
+// The cumulative savings are kept in memory if the ledger path is empty, otherwise in the file of the path.
+func NewEstimator(prices *PriceTable, period time.Duration, ledgerPath string) *Estimator {
+	return &Estimator{
+		prices:     prices,
+		period:     period,
+		ledgerPath: ledgerPath,
+	}
+}
+
+// Estimate estimates the savings of the run by the node pools, the running nodes and the drained on-demand nodes, which may be empty.
+func (e *Estimator) Estimate(nodePools []*gke.NodePool, nodes []*gke.Node, drainedOndemandNodes []*gke.Node) (*Estimate, error) {
+	machineTypes := make(map[string]string, len(nodePools))
+	for _, v := range nodePools {
+		machineTypes[v.Name] = v.MachineType
+	}
+	unknown := make(map[string]bool)
+	price := func(node *gke.Node) (Price, bool) {
+		p, ok := e.prices.Get(machineTypes[node.NodePool])
+		if !ok {
+			unknown[machineTypes[node.NodePool]] = true
+		}
+		return p, ok
+	}
+	ret := &Estimate{Currency: e.prices.Currency, Period: e.period}
+	for _, v := range nodes {
+		if !v.Preemptible {
+			continue
+		}
+		if p, ok := price(v); ok {
+			ret.PreemptibleSavingsPerHour += p.Ondemand - p.Preemptible
+		}
+	}
+	for _, v := range drainedOndemandNodes {
+		if p, ok := price(v); ok {
+			ret.OndemandSavingsPerHour += p.Ondemand
+		}
+	}
+	ret.Savings = (ret.PreemptibleSavingsPerHour + ret.OndemandSavingsPerHour) * e.period.Hours()
+	for k := range unknown {
+		ret.UnknownMachineTypes = append(ret.UnknownMachineTypes, k)
+	}
+	sort.Strings(ret.UnknownMachineTypes)
+
+	// accumulate
+	if err := e.load(); err != nil {
+		return ret, err
+	}
+	if e.ledger.Since.IsZero() || e.ledger.Currency != ret.Currency {
+		e.ledger = ledger{Currency: ret.Currency, Since: time.Now()} // reset if the currency is changed
+	}
+	e.ledger.Runs++
+	e.ledger.Savings += ret.Savings
+	ret.CumulativeSavings = e.ledger.Savings
+	ret.CumulativeRuns = e.ledger.Runs
+	ret.CumulativeSince = e.ledger.Since
+	return ret, e.save()
+}
+
+//
+func (e *Estimator) load() error {
+	if e.ledgerPath == "" {
+		return nil
+	}
+	b, err := os.ReadFile(e.ledgerPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cost ledger %s: %s", e.ledgerPath, err)
+	}
+	if err := json.Unmarshal(b, &e.ledger); err != nil {
+		return fmt.Errorf("failed to parse cost ledger %s: %s", e.ledgerPath, err)
+	}
+	return nil
+}
+
+//
+func (e *Estimator) save() error {
+	if e.ledgerPath == "" {
+		return nil
+	}
+	b, err := json.Marshal(e.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cost ledger: %s", err)
+	}
+	if err := os.WriteFile(e.ledgerPath, b, 0644); err != nil {
+		return fmt.Errorf("failed to write cost ledger %s: %s", e.ledgerPath, err)
+	}
+	return nil
+}
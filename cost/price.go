@@ -0,0 +1,121 @@
+package cost
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultCurrency is the currency of the price table if not specified.
+const DefaultCurrency = "USD"
+
+// Price is the hourly price of a machine type.
+type Price struct {
+	MachineType string  `json:"machineType"`
+	Ondemand    float64 `json:"ondemand"`
+	Preemptible float64 `json:"preemptible"`
+}
+
+// PriceTable is the hourly prices by the machine type.
+type PriceTable struct {
+	Currency string
+	Prices   map[string]Price
+}
+
+//
+type priceTableFile struct {
+	Currency string  `json:"currency"`
+	Prices   []Price `json:"prices"`
+}
+
+// LoadPriceTable reads the price table from the YAML file or the CSV file.
+//
+// The YAML file has the currency and the list of prices:
+//
+//	currency: USD
+//	prices:
+//	- machineType: e2-standard-4
+//	  ondemand: 0.134
+//	  preemptible: 0.040
+//
+// The CSV file has the header line and the prices in the currency USD:
+//
+//	machine_type,ondemand,preemptible
+//	e2-standard-4,0.134,0.040
+func LoadPriceTable(path string) (*PriceTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open price table %s: %s", path, err)
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return parseYAML(f)
+	case ".csv":
+		return parseCSV(f)
+	}
+	return nil, fmt.Errorf("unsupported price table extension: %s", path)
+}
+
+// Get returns the price of the machine type.
+func (t *PriceTable) Get(machineType string) (Price, bool) {
+	p, ok := t.Prices[machineType]
+	return p, ok
+}
+
+//
+func parseYAML(r io.Reader) (*PriceTable, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %s", err)
+	}
+	var in priceTableFile
+	if err := yaml.UnmarshalStrict(b, &in); err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %s", err)
+	}
+	ret := &PriceTable{Currency: in.Currency, Prices: make(map[string]Price, len(in.Prices))}
+	if ret.Currency == "" {
+		ret.Currency = DefaultCurrency
+	}
+	for _, v := range in.Prices {
+		if v.MachineType == "" {
+			return nil, fmt.Errorf("machine type of price is empty")
+		}
+		ret.Prices[v.MachineType] = v
+	}
+	return ret, nil
+}
+
+//
+func parseCSV(r io.Reader) (*PriceTable, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %s", err)
+	}
+	ret := &PriceTable{Currency: DefaultCurrency, Prices: make(map[string]Price, len(records))}
+	for i, v := range records {
+		if i == 0 {
+			continue // header
+		}
+		if len(v) != 3 {
+			return nil, fmt.Errorf("unexpected number of columns at line %d: %d", i+1, len(v))
+		}
+		ondemand, err := strconv.ParseFloat(strings.TrimSpace(v[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ondemand price at line %d: %s", i+1, err)
+		}
+		preemptible, err := strconv.ParseFloat(strings.TrimSpace(v[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse preemptible price at line %d: %s", i+1, err)
+		}
+		machineType := strings.TrimSpace(v[0])
+		ret.Prices[machineType] = Price{MachineType: machineType, Ondemand: ondemand, Preemptible: preemptible}
+	}
+	return ret, nil
+}
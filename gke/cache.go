@@ -0,0 +1,170 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	coreListerV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	podNodeNameIndex = "spec.nodeName"
+)
+
+// Snapshot is the consistent state of the cluster used by a run.
+type Snapshot struct {
+	Time           time.Time
+	Nodes          []*coreV1.Node
+	PodsByNodeName map[string][]*coreV1.Pod
+	// NotReadyAt is the time when the nodes became not ready since the previous snapshot, including the nodes which are ready again.
+	NotReadyAt map[string]time.Time
+}
+
+// Cache keeps the state of nodes and pods by the shared informers.
+type Cache struct {
+	factory   informers.SharedInformerFactory
+	nodes     coreListerV1.NodeLister
+	pods      cache.SharedIndexInformer
+	synced    []cache.InformerSynced
+	mu        sync.Mutex
+	notReady  map[string]time.Time
+	startOnce sync.Once
+}
+
+//
+func NewCache(kubernetesClient kubernetes.Interface, resync time.Duration) *Cache {
+	factory := informers.NewSharedInformerFactory(kubernetesClient, resync)
+	nodeInformer := factory.Core().V1().Nodes()
+	podInformer := factory.Core().V1().Pods().Informer()
+	_ = podInformer.AddIndexers(cache.Indexers{
+		podNodeNameIndex: func(obj interface{}) ([]string, error) {
+			pod, ok := obj.(*coreV1.Pod)
+			if !ok || pod.Spec.NodeName == "" {
+				return nil, nil
+			}
+			return []string{pod.Spec.NodeName}, nil
+		},
+	})
+	c := &Cache{
+		factory:  factory,
+		nodes:    nodeInformer.Lister(),
+		pods:     podInformer,
+		notReady: make(map[string]time.Time),
+	}
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: c.onNodeUpdate,
+		DeleteFunc: c.onNodeDelete,
+	})
+	c.synced = []cache.InformerSynced{
+		nodeInformer.Informer().HasSynced,
+		podInformer.HasSynced,
+	}
+	return c
+}
+
+// Start starts the informers until the context is done.
+func (c *Cache) Start(ctx context.Context) {
+	c.startOnce.Do(func() {
+		c.factory.Start(ctx.Done())
+	})
+}
+
+// WaitForSync waits until the informers are synced or the context is done.
+func (c *Cache) WaitForSync(ctx context.Context) error {
+	c.Start(ctx)
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced...) {
+		return fmt.Errorf("failed to wait for cache sync: %s", ctx.Err())
+	}
+	return nil
+}
+
+// Snapshot returns the copy of the current state, which is not changed by subsequent events.
+// The nodes which became not ready are reset by the snapshot.
+func (c *Cache) Snapshot() (*Snapshot, error) {
+	nodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes from cache: %s", err)
+	}
+	c.mu.Lock()
+	notReady := c.notReady
+	c.notReady = make(map[string]time.Time)
+	c.mu.Unlock()
+	ret := &Snapshot{
+		Time:           time.Now(),
+		Nodes:          make([]*coreV1.Node, 0, len(nodes)),
+		PodsByNodeName: make(map[string][]*coreV1.Pod, len(nodes)),
+		NotReadyAt:     notReady,
+	}
+	for _, v := range nodes {
+		ret.Nodes = append(ret.Nodes, v.DeepCopy())
+		objs, err := c.pods.GetIndexer().ByIndex(podNodeNameIndex, v.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods on node %s from cache: %s", v.Name, err)
+		}
+		pods := make([]*coreV1.Pod, 0, len(objs))
+		for _, obj := range objs {
+			if pod, ok := obj.(*coreV1.Pod); ok {
+				pods = append(pods, pod.DeepCopy())
+			}
+		}
+		ret.PodsByNodeName[v.Name] = pods
+	}
+	return ret, nil
+}
+
+//
+func (c *Cache) onNodeUpdate(oldObj, newObj interface{}) {
+	oldNode, ok1 := oldObj.(*coreV1.Node)
+	newNode, ok2 := newObj.(*coreV1.Node)
+	if !ok1 || !ok2 {
+		return
+	}
+	wasReady, isReady := isNodeReady(oldNode), isNodeReady(newNode)
+	if wasReady == isReady {
+		return
+	}
+	logger := log.WithFields(log.Fields{log.FieldNode: newNode.Name, log.FieldPool: newNode.Labels[NodePoolLabel]})
+	if isReady {
+		logger.Infof("Detected node became ready: %s", newNode.Name) // kept until the next snapshot
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.notReady[newNode.Name]; !ok {
+		c.notReady[newNode.Name] = time.Now()
+	}
+	logger.Warnf("Detected node became not ready: %s", newNode.Name)
+}
+
+//
+func (c *Cache) onNodeDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	node, ok := obj.(*coreV1.Node)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.notReady, node.Name)
+}
+
+//
+func isNodeReady(node *coreV1.Node) bool {
+	for _, v := range node.Status.Conditions {
+		if v.Type == coreV1.NodeReady {
+			return v.Status == coreV1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DisruptionPolicy is how the optimizer treats the node running the pods which should not be disrupted, such as the running jobs.
+type DisruptionPolicy string
+
+//
+const (
+	// DisruptionPolicyEvict evicts the pods as the others.
+	DisruptionPolicyEvict DisruptionPolicy = "evict"
+	// DisruptionPolicyPenalize prefers the other nodes as the target, and evicts the pods if the node is selected.
+	DisruptionPolicyPenalize DisruptionPolicy = "penalize"
+	// DisruptionPolicyWait prefers the other nodes as the target, and waits for the pods to complete after the cordon.
+	DisruptionPolicyWait DisruptionPolicy = "wait"
+	// DisruptionPolicySkip never selects the node as the target.
+	DisruptionPolicySkip DisruptionPolicy = "skip"
+)
+
+// DoNotDisruptAnnotation is the annotation of the pod which should not be disrupted, such as the long running batch.
+const DoNotDisruptAnnotation = AnnotationPrefix + "do-not-disrupt"
+
+// disruptionPolicyRanks is the strictness of the policies, used to choose the policy of the node.
+var disruptionPolicyRanks = map[DisruptionPolicy]int{
+	DisruptionPolicyEvict:    0,
+	DisruptionPolicyPenalize: 1,
+	DisruptionPolicyWait:     2,
+	DisruptionPolicySkip:     3,
+}
+
+// ParseDisruptionPolicy returns the policy of the name, or evict if empty.
+func ParseDisruptionPolicy(name string) (DisruptionPolicy, error) {
+	if name == "" {
+		return DisruptionPolicyEvict, nil
+	}
+	policy := DisruptionPolicy(strings.ToLower(name))
+	if _, ok := disruptionPolicyRanks[policy]; !ok {
+		return "", fmt.Errorf("unknown disruption policy: %s", name)
+	}
+	return policy, nil
+}
+
+// ParseNamespaceDisruptionPolicies returns the policies by the namespace from the policy names by the namespace.
+func ParseNamespaceDisruptionPolicies(in map[string]string) (map[string]DisruptionPolicy, error) {
+	ret := make(map[string]DisruptionPolicy, len(in))
+	for namespace, name := range in {
+		policy, err := ParseDisruptionPolicy(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse disruption policy of namespace %s: %s", namespace, err)
+		}
+		ret[namespace] = policy
+	}
+	return ret, nil
+}
+
+// DisruptionOption is the policy of the pods owned by the jobs or annotated by DoNotDisruptAnnotation.
+type DisruptionOption struct {
+	// Policy is the policy of the namespaces not in NamespacePolicies. Evict if empty.
+	Policy            DisruptionPolicy
+	NamespacePolicies map[string]DisruptionPolicy
+	// WaitTimeout is the maximum time to wait for the pods to complete on each node by the wait policy.
+	// The pods still running are evicted after the timeout.
+	WaitTimeout time.Duration
+}
+
+// PolicyOf returns the policy of the pod, which is evict if the pod can be disrupted.
+// The running pod of the optimizer is always evict, since it is also owned by the job.
+func (o DisruptionOption) PolicyOf(pod *Pod) DisruptionPolicy {
+	if !pod.IsDisruptionSensitive() || pod.IsTerminated() || isSelfPod(pod) {
+		return DisruptionPolicyEvict
+	}
+	if v, ok := o.NamespacePolicies[pod.Namespace]; ok {
+		return v
+	}
+	if o.Policy == "" {
+		return DisruptionPolicyEvict
+	}
+	return o.Policy
+}
+
+// NodePolicy returns the strictest policy of the pods on the node, and the pods protected by the policy.
+func (o DisruptionOption) NodePolicy(node *Node) (DisruptionPolicy, []*Pod) {
+	policy := DisruptionPolicyEvict
+	var pods []*Pod
+	for _, v := range node.Pods {
+		p := o.PolicyOf(v)
+		if p == DisruptionPolicyEvict {
+			continue
+		}
+		pods = append(pods, v)
+		if disruptionPolicyRanks[p] > disruptionPolicyRanks[policy] {
+			policy = p
+		}
+	}
+	return policy, pods
+}
+
+// IsDisruptionSensitive returns true if the pod is owned by the job, or annotated not to be disrupted.
+// The pods of the cron jobs are also owned by the jobs.
+func (p *Pod) IsDisruptionSensitive() bool {
+	if p.OwnerKind == "Job" {
+		return true
+	}
+	return p.Annotations[DoNotDisruptAnnotation] == "true" || p.Annotations[SafeToEvictAnnotation] == "false"
+}
+
+//
+func isSelfPod(pod *Pod) bool {
+	namespace, name, ok := selfPod()
+	return ok && pod.Namespace == namespace && pod.Name == name
+}
+
+// waitForPodsCompleted waits for the pods protected by the wait policy on the cordoned node to complete, up to the wait timeout.
+// It returns an error only if the context is canceled, and the pods still running are evicted by the drain.
+func (cli *client) waitForPodsCompleted(ctx context.Context, node *Node) error {
+	option := cli.option.Disruption
+	pods := make([]*Pod, 0, len(node.Pods))
+	for _, v := range node.Pods {
+		if option.PolicyOf(v) == DisruptionPolicyWait {
+			pods = append(pods, v)
+		}
+	}
+	if len(pods) == 0 || option.WaitTimeout <= 0 {
+		return nil
+	}
+	logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool})
+	deadline := time.Now().Add(option.WaitTimeout)
+	for {
+		running := make([]*Pod, 0, len(pods))
+		for _, v := range pods {
+			completed, err := cli.isPodCompleted(ctx, v)
+			if err != nil {
+				logger.Warnf("Failed to get pod %s/%s: %s", v.Namespace, v.Name, err)
+			}
+			if !completed {
+				running = append(running, v)
+			}
+		}
+		pods = running
+		if len(pods) == 0 {
+			logger.Infof("Succeeded in waiting for protected pods on %s to complete", node.Name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			logger.Warnf("Timed out waiting for protected pods on %s to complete after %s, and evict them: %s", node.Name, option.WaitTimeout, podNames(pods))
+			return nil
+		}
+		logger.Infof("Waiting for protected pods on %s to complete: %s", node.Name, podNames(pods))
+		if err := sleep(ctx, PodPollInterval); err != nil {
+			return fmt.Errorf("aborted waiting for protected pods to complete: %s", err)
+		}
+	}
+}
+
+// isPodCompleted returns true if the pod has finished, or is deleted.
+func (cli *client) isPodCompleted(ctx context.Context, pod *Pod) (bool, error) {
+	var current *coreV1.Pod
+	err := cli.retry(ctx, "GetPod", func(ctx context.Context) (err error) {
+		current, err = cli.kubernetesClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metaV1.GetOptions{})
+		return err
+	})
+	if apiErrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if pod.UID != "" && string(current.UID) != pod.UID {
+		return true, nil
+	}
+	return current.Status.Phase == coreV1.PodSucceeded || current.Status.Phase == coreV1.PodFailed, nil
+}
+
+//
+func podNames(pods []*Pod) string {
+	names := make([]string, 0, len(pods))
+	for _, v := range pods {
+		names = append(names, v.Namespace+"/"+v.Name)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,92 @@
+package gke
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+)
+
+//
+func TestDisruptionOptionPolicyOf(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("hostname is not available: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "namespace")
+	if err := os.WriteFile(path, []byte("optimizer\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(v string) { serviceAccountNamespacePath = v }(serviceAccountNamespacePath)
+	serviceAccountNamespacePath = path
+
+	option := DisruptionOption{
+		Policy:            DisruptionPolicyWait,
+		NamespacePolicies: map[string]DisruptionPolicy{"batch": DisruptionPolicySkip, "dev": DisruptionPolicyEvict},
+	}
+	tests := []struct {
+		name   string
+		option DisruptionOption
+		pod    *Pod
+		want   DisruptionPolicy
+	}{
+		{"not sensitive", option, &Pod{Name: "web", Namespace: "default", OwnerKind: "Deployment"}, DisruptionPolicyEvict},
+		{"job", option, &Pod{Name: "job", Namespace: "default", OwnerKind: "Job"}, DisruptionPolicyWait},
+		{"do not disrupt", option, &Pod{Name: "web", Namespace: "default", OwnerKind: "Deployment", Annotations: map[string]string{DoNotDisruptAnnotation: "true"}}, DisruptionPolicyWait},
+		{"not safe to evict", option, &Pod{Name: "web", Namespace: "default", OwnerKind: "Deployment", Annotations: map[string]string{SafeToEvictAnnotation: "false"}}, DisruptionPolicyWait},
+		{"safe to evict", option, &Pod{Name: "web", Namespace: "default", OwnerKind: "Deployment", Annotations: map[string]string{SafeToEvictAnnotation: "true"}}, DisruptionPolicyEvict},
+		{"namespace policy", option, &Pod{Name: "job", Namespace: "batch", OwnerKind: "Job"}, DisruptionPolicySkip},
+		{"namespace evict", option, &Pod{Name: "job", Namespace: "dev", OwnerKind: "Job"}, DisruptionPolicyEvict},
+		{"terminated", option, &Pod{Name: "job", Namespace: "default", OwnerKind: "Job", Status: coreV1.PodStatus{Phase: coreV1.PodSucceeded}}, DisruptionPolicyEvict},
+		{"optimizer itself", option, &Pod{Name: hostname, Namespace: "optimizer", OwnerKind: "Job"}, DisruptionPolicyEvict},
+		{"same name in other namespace", option, &Pod{Name: hostname, Namespace: "default", OwnerKind: "Job"}, DisruptionPolicyWait},
+		{"default policy", DisruptionOption{}, &Pod{Name: "job", Namespace: "default", OwnerKind: "Job"}, DisruptionPolicyEvict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.option.PolicyOf(tt.pod); got != tt.want {
+				t.Errorf("unexpected policy: got=%s, want=%s", got, tt.want)
+			}
+		})
+	}
+}
+
+//
+func TestDisruptionOptionNodePolicy(t *testing.T) {
+	option := DisruptionOption{
+		Policy: DisruptionPolicyPenalize,
+		NamespacePolicies: map[string]DisruptionPolicy{
+			"wait": DisruptionPolicyWait,
+			"skip": DisruptionPolicySkip,
+		},
+	}
+	web := &Pod{Name: "web", Namespace: "default", OwnerKind: "Deployment"}
+	penalize := &Pod{Name: "job", Namespace: "default", OwnerKind: "Job"}
+	wait := &Pod{Name: "job", Namespace: "wait", OwnerKind: "Job"}
+	skip := &Pod{Name: "job", Namespace: "skip", OwnerKind: "Job"}
+	tests := []struct {
+		name      string
+		pods      []*Pod
+		policy    DisruptionPolicy
+		protected []*Pod
+	}{
+		{"no pods", nil, DisruptionPolicyEvict, nil},
+		{"no protected pods", []*Pod{web}, DisruptionPolicyEvict, nil},
+		{"penalize", []*Pod{web, penalize}, DisruptionPolicyPenalize, []*Pod{penalize}},
+		{"wait is stricter than penalize", []*Pod{penalize, wait}, DisruptionPolicyWait, []*Pod{penalize, wait}},
+		{"skip is the strictest", []*Pod{skip, wait, penalize, web}, DisruptionPolicySkip, []*Pod{skip, wait, penalize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, pods := option.NodePolicy(&Node{Name: "node", Pods: tt.pods})
+			if policy != tt.policy {
+				t.Errorf("unexpected policy: got=%s, want=%s", policy, tt.policy)
+			}
+			if !reflect.DeepEqual(pods, tt.protected) {
+				t.Errorf("unexpected protected pods: got=%d, want=%d", len(pods), len(tt.protected))
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	EventComponent          = "gke-node-optimizer"
+	EventReasonTaint        = "OptimizerTaint"
+	EventReasonCordon       = "OptimizerCordon"
+	EventReasonUncordon     = "OptimizerUncordon"
+	EventReasonEvict        = "OptimizerEvict"
+	EventReasonForceDelete  = "OptimizerForceDelete"
+	EventReasonRestart      = "OptimizerRestart"
+	EventReasonDelete       = "OptimizerDelete"
+	EventReasonStop         = "OptimizerStop"
+	EventReasonSummary      = "OptimizerSummary"
+	ServiceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+//
+func nodeReference(name string, uid types.UID) *coreV1.ObjectReference {
+	return &coreV1.ObjectReference{
+		Kind:       "Node",
+		APIVersion: "v1",
+		Name:       name,
+		UID:        uid,
+	}
+}
+
+//
+func podReference(pod *Pod) *coreV1.ObjectReference {
+	return &coreV1.ObjectReference{
+		Kind:       "Pod",
+		APIVersion: "v1",
+		Name:       pod.Name,
+		Namespace:  pod.Namespace,
+		UID:        types.UID(pod.UID),
+	}
+}
+
+// recordEvent creates the event of the involved object, and only logs if it fails.
+func (cli *client) recordEvent(ctx context.Context, ref *coreV1.ObjectReference, eventType, reason, message string) {
+	if !cli.option.RecordEvents {
+		return
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = metaV1.NamespaceDefault // cluster scoped object such as node
+	}
+	hostname, _ := os.Hostname()
+	now := metaV1.NewTime(time.Now())
+	event := &coreV1.Event{
+		ObjectMeta: metaV1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    namespace,
+		},
+		InvolvedObject:      *ref,
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Count:               1,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Source:              coreV1.EventSource{Component: EventComponent},
+		ReportingController: EventComponent,
+		ReportingInstance:   hostname,
+	}
+	if _, err := cli.kubernetesClient.CoreV1().Events(namespace).Create(ctx, event, metaV1.CreateOptions{}); err != nil {
+		log.WithFields(log.Fields{log.FieldNamespace: ref.Namespace}).Warnf("Failed to record event: kind=%s, name=%s, reason=%s: %s", ref.Kind, ref.Name, reason, err)
+	}
+}
+
+//
+func (cli *client) RecordSummaryEvent(ctx context.Context, failed bool, message string) error {
+	if !cli.option.RecordEvents {
+		return nil
+	}
+	refs, err := cli.ownerReferences(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get owner references: %s", err)
+	}
+	if len(refs) == 0 {
+		log.Info("Skip summary event because owner job does not exist")
+		return nil
+	}
+	eventType := coreV1.EventTypeNormal
+	if failed {
+		eventType = coreV1.EventTypeWarning
+	}
+	for _, ref := range refs {
+		cli.recordEvent(ctx, ref, eventType, EventReasonSummary, message)
+	}
+	return nil
+}
+
+// serviceAccountNamespacePath is the file of the namespace of the running pod, which is replaced by the tests.
+var serviceAccountNamespacePath = ServiceAccountNamespace
+
+// selfPod returns the namespace and the name of the running pod, or false if not running in the cluster.
+func selfPod() (namespace, name string, ok bool) {
+	b, err := os.ReadFile(serviceAccountNamespacePath)
+	if err != nil {
+		return "", "", false
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", "", false
+	}
+	return strings.TrimSpace(string(b)), hostname, true
+}
+
+// ownerReferences returns the job and the cronjob which owns the running pod.
+func (cli *client) ownerReferences(ctx context.Context) ([]*coreV1.ObjectReference, error) {
+	namespace, hostname, ok := selfPod()
+	if !ok {
+		return nil, nil // not running in the cluster
+	}
+	pod, err := cli.kubernetesClient.CoreV1().Pods(namespace).Get(ctx, hostname, metaV1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s: %s", hostname, err)
+	}
+	refs := make([]*coreV1.ObjectReference, 0, 2)
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind != "Job" {
+			continue
+		}
+		refs = append(refs, &coreV1.ObjectReference{
+			Kind:       owner.Kind,
+			APIVersion: owner.APIVersion,
+			Name:       owner.Name,
+			Namespace:  namespace,
+			UID:        owner.UID,
+		})
+		job, err := cli.kubernetesClient.BatchV1().Jobs(namespace).Get(ctx, owner.Name, metaV1.GetOptions{})
+		if err != nil {
+			return refs, fmt.Errorf("failed to get job %s: %s", owner.Name, err)
+		}
+		for _, v := range job.OwnerReferences {
+			if v.Kind == "CronJob" {
+				refs = append(refs, &coreV1.ObjectReference{
+					Kind:       v.Kind,
+					APIVersion: v.APIVersion,
+					Name:       v.Name,
+					Namespace:  namespace,
+					UID:        v.UID,
+				})
+			}
+		}
+	}
+	return refs, nil
+}
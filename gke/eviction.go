@@ -0,0 +1,240 @@
+package gke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+	"github.com/na-ga/gke-node-optimizer/tracing"
+
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+//
+const (
+	EvictionOutcomeEvicted      EvictionOutcome = "evicted"
+	EvictionOutcomeNotFound     EvictionOutcome = "not-found"
+	EvictionOutcomeBlocked      EvictionOutcome = "blocked"
+	EvictionOutcomeForbidden    EvictionOutcome = "forbidden"
+	EvictionOutcomeFailed       EvictionOutcome = "failed"
+	EvictionOutcomeAborted      EvictionOutcome = "aborted"
+	EvictionOutcomeStuck        EvictionOutcome = "stuck"         // evicted but not deleted within the deletion timeout
+	EvictionOutcomeForceDeleted EvictionOutcome = "force-deleted" // deleted directly after blocked or stuck
+	EvictionOutcomeRestarted    EvictionOutcome = "restarted"     // replaced by the rollout restart of the single replica deployment
+)
+
+// EvictionOutcome is the final outcome of the eviction of a pod.
+type EvictionOutcome string
+
+// EvictionOption is the retry policy of the eviction of a pod.
+type EvictionOption struct {
+	// MaxAttempts is the maximum number of attempts including the first call. No retry if less than 2.
+	MaxAttempts int
+	// RetryInterval is the interval before the next attempt if the API server does not suggest it by Retry-After.
+	RetryInterval time.Duration
+	// MaxRetryInterval is the upper limit of the interval suggested by Retry-After.
+	MaxRetryInterval time.Duration
+	// GracePeriod overrides the termination grace period of the pods if positive.
+	GracePeriod time.Duration
+	// DeletionTimeout is the maximum time to wait for the evicted pods to be deleted, or not to wait if 0.
+	DeletionTimeout time.Duration
+	// ForceDeleteNamespaces is the namespaces whose pods are deleted directly if the eviction is blocked or stuck.
+	ForceDeleteNamespaces []string
+	// ReadinessTimeout is the maximum time to wait for the evicted pod of the stateful set to be ready again before evicting its next pod,
+	// and for the rollout of the restarted deployment. The stateful sets are not waited for, and the deployments are not restarted if 0.
+	ReadinessTimeout time.Duration
+	// RestartSingleReplica restarts the deployment which has only one replica with the surge instead of evicting its pod, if ReadinessTimeout is positive.
+	RestartSingleReplica bool
+}
+
+//
+func (o EvictionOption) gracePeriodSeconds() *int64 {
+	if o.GracePeriod <= 0 {
+		return nil
+	}
+	seconds := int64(o.GracePeriod / time.Second)
+	return &seconds
+}
+
+//
+func (o EvictionOption) canForceDelete(namespace string) bool {
+	for _, v := range o.ForceDeleteNamespaces {
+		if v == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Eviction is the result of the eviction of a pod.
+type Eviction struct {
+	Pod      *Pod
+	Outcome  EvictionOutcome
+	Attempts int
+	Err      error
+	// EscalatedFrom is the outcome before the pod is force deleted.
+	EscalatedFrom EvictionOutcome
+}
+
+// Succeeded returns true if the pod is evicted, force deleted or has already gone.
+func (e *Eviction) Succeeded() bool {
+	return e.Outcome == EvictionOutcomeEvicted || e.Outcome == EvictionOutcomeForceDeleted || e.Outcome == EvictionOutcomeNotFound || e.Outcome == EvictionOutcomeRestarted
+}
+
+// EvictionError is the error of the eviction which is given up.
+type EvictionError struct {
+	*Eviction
+}
+
+//
+func (e *EvictionError) Error() string {
+	return fmt.Sprintf("failed to evict pod %s (outcome=%s, count=%d): %s", e.Pod.Name, e.Outcome, e.Attempts, e.Err)
+}
+
+//
+func (e *EvictionError) Unwrap() error {
+	return e.Err
+}
+
+// EvictedPods returns the pods which are evicted, force deleted or restarted actually.
+func EvictedPods(evictions []*Eviction) []*Pod {
+	ret := make([]*Pod, 0, len(evictions))
+	for _, v := range evictions {
+		if v.Outcome == EvictionOutcomeEvicted || v.Outcome == EvictionOutcomeForceDeleted || v.Outcome == EvictionOutcomeRestarted {
+			ret = append(ret, v.Pod)
+		}
+	}
+	return ret
+}
+
+// classifyEviction returns the outcome of the error of the eviction, and whether to retry it.
+// The pod disruption budget rejects the eviction by 429 Too Many Requests, and the pod which has already gone returns 404 Not Found.
+func classifyEviction(err error) (outcome EvictionOutcome, retryable bool) {
+	switch {
+	case err == nil:
+		return EvictionOutcomeEvicted, false
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return EvictionOutcomeAborted, false
+	case apiErrors.IsNotFound(err):
+		return EvictionOutcomeNotFound, false
+	case apiErrors.IsTooManyRequests(err):
+		return EvictionOutcomeBlocked, true
+	case apiErrors.IsForbidden(err):
+		return EvictionOutcomeForbidden, false
+	}
+	return EvictionOutcomeFailed, isRetryable(err)
+}
+
+// evictionRetryInterval returns the interval suggested by Retry-After up to the maximum, or the default interval.
+func evictionRetryInterval(option EvictionOption, err error) time.Duration {
+	seconds, ok := apiErrors.SuggestsClientDelay(err)
+	if !ok || seconds <= 0 {
+		return option.RetryInterval
+	}
+	interval := time.Duration(seconds) * time.Second
+	if option.MaxRetryInterval > 0 && interval > option.MaxRetryInterval {
+		return option.MaxRetryInterval
+	}
+	return interval
+}
+
+// waitForPodsDeleted waits for the evicted pods to disappear from the node up to the deletion timeout.
+// The pods which remain after the timeout are deleted directly with the grace period override, or without the grace period, if allowed, otherwise regarded as stuck.
+func (cli *client) waitForPodsDeleted(ctx context.Context, node *Node, evictions []*Eviction) error {
+	logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool})
+	pending := make([]*Eviction, 0, len(evictions))
+	for _, v := range evictions {
+		if v.Outcome == EvictionOutcomeEvicted {
+			pending = append(pending, v)
+		}
+	}
+	timeout := cli.option.Eviction.DeletionTimeout
+	deadline := time.Now().Add(timeout)
+	for len(pending) > 0 {
+		remaining := pending[:0]
+		for _, v := range pending {
+			deleted, err := cli.isPodDeleted(ctx, v.Pod)
+			if err != nil {
+				return fmt.Errorf("failed to get pod %s: %s", v.Pod.Name, err)
+			}
+			if !deleted {
+				remaining = append(remaining, v)
+			}
+		}
+		pending = remaining
+		if len(pending) == 0 || time.Now().After(deadline) {
+			break
+		}
+		logger.Infof("Waiting for evicted pods to be deleted from node %s: pods=%d", node.Name, len(pending))
+		if err := sleep(ctx, PodPollInterval); err != nil {
+			return fmt.Errorf("aborted waiting for evicted pods to be deleted from node %s: %s", node.Name, err)
+		}
+	}
+	gracePeriodSeconds := cli.option.Eviction.gracePeriodSeconds()
+	if gracePeriodSeconds == nil {
+		noGracePeriod := int64(0) // the pod's own grace period has already passed
+		gracePeriodSeconds = &noGracePeriod
+	}
+	for _, v := range pending {
+		v.Outcome = EvictionOutcomeStuck
+		v.Err = fmt.Errorf("pod is not deleted within %s", timeout)
+		if cli.option.Eviction.canForceDelete(v.Pod.Namespace) {
+			cli.forceDeletePod(ctx, node, v, gracePeriodSeconds)
+		}
+		if !v.Succeeded() {
+			return &EvictionError{Eviction: v}
+		}
+	}
+	return nil
+}
+
+// isPodDeleted returns true if the pod is not found, or replaced by the pod which has the same name.
+func (cli *client) isPodDeleted(ctx context.Context, pod *Pod) (bool, error) {
+	var current *coreV1.Pod
+	err := cli.retry(ctx, "GetPod", func(ctx context.Context) (err error) {
+		current, err = cli.kubernetesClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metaV1.GetOptions{})
+		return err
+	})
+	if apiErrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return pod.UID != "" && string(current.UID) != pod.UID, nil
+}
+
+// forceDeletePod deletes the pod directly instead of the eviction, which ignores the pod disruption budget.
+func (cli *client) forceDeletePod(ctx context.Context, node *Node, eviction *Eviction, gracePeriodSeconds *int64) {
+	pod := eviction.Pod
+	logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool, log.FieldPod: pod.Name, log.FieldNamespace: pod.Namespace})
+	logger.Warnf("Force delete pod %s because the eviction is %s: %s", pod.Name, eviction.Outcome, eviction.Err)
+	if err := cli.deletePod(ctx, pod, gracePeriodSeconds); err != nil && !apiErrors.IsNotFound(err) {
+		eviction.Err = fmt.Errorf("failed to force delete pod %s: %s: %s", pod.Name, err, eviction.Err)
+		return
+	}
+	eviction.EscalatedFrom = eviction.Outcome
+	eviction.Outcome = EvictionOutcomeForceDeleted
+	eviction.Err = nil
+	logger.Infof("Succeeded in force deleted pod %s on node %s", pod.Name, node.Name)
+	message := fmt.Sprintf("Force deleted by %s to refresh node %s because the eviction is %s", EventComponent, node.Name, eviction.EscalatedFrom)
+	cli.recordEvent(ctx, podReference(pod), coreV1.EventTypeWarning, EventReasonForceDelete, message)
+	cli.recordEvent(ctx, nodeReference(node.Name, types.UID(node.UID)), coreV1.EventTypeWarning, EventReasonForceDelete, fmt.Sprintf("Pod %s/%s force deleted by %s", pod.Namespace, pod.Name, EventComponent))
+}
+
+//
+func (cli *client) deletePod(ctx context.Context, pod *Pod, gracePeriodSeconds *int64) (err error) {
+	ctx, span := tracing.Start(ctx, "DeletePod", tracing.AttributePod.String(pod.Name), tracing.AttributeNamespace.String(pod.Namespace))
+	defer func() { tracing.End(span, err) }()
+	option := metaV1.DeleteOptions{GracePeriodSeconds: gracePeriodSeconds}
+	if pod.UID != "" {
+		uid := types.UID(pod.UID)
+		option.Preconditions = &metaV1.Preconditions{UID: &uid}
+	}
+	return cli.kubernetesClient.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, option)
+}
@@ -0,0 +1,159 @@
+package gke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+//
+func TestClassifyEviction(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name      string
+		err       error
+		outcome   EvictionOutcome
+		retryable bool
+	}{
+		{"evicted", nil, EvictionOutcomeEvicted, false},
+		{"canceled", context.Canceled, EvictionOutcomeAborted, false},
+		{"deadline exceeded", fmt.Errorf("wrapped: %w", context.DeadlineExceeded), EvictionOutcomeAborted, false},
+		{"404", apiErrors.NewNotFound(pods, "pod"), EvictionOutcomeNotFound, false},
+		{"429 with retry after", apiErrors.NewTooManyRequests("disruption budget", 10), EvictionOutcomeBlocked, true},
+		{"429 without retry after", apiErrors.NewTooManyRequests("disruption budget", 0), EvictionOutcomeBlocked, true},
+		{"403", apiErrors.NewForbidden(pods, "pod", errors.New("denied")), EvictionOutcomeForbidden, false},
+		{"500", apiErrors.NewInternalError(errors.New("internal")), EvictionOutcomeFailed, true},
+		{"409", apiErrors.NewConflict(pods, "pod", errors.New("conflict")), EvictionOutcomeFailed, true},
+		{"400", apiErrors.NewBadRequest("bad request"), EvictionOutcomeFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, retryable := classifyEviction(tt.err)
+			if outcome != tt.outcome || retryable != tt.retryable {
+				t.Errorf("unexpected classification: got=(%s, %t), want=(%s, %t)", outcome, retryable, tt.outcome, tt.retryable)
+			}
+		})
+	}
+}
+
+//
+func TestEvictionRetryInterval(t *testing.T) {
+	option := EvictionOption{RetryInterval: 5 * time.Second, MaxRetryInterval: time.Minute}
+	tests := []struct {
+		name   string
+		option EvictionOption
+		err    error
+		want   time.Duration
+	}{
+		{"429 with retry after", option, apiErrors.NewTooManyRequests("disruption budget", 10), 10 * time.Second},
+		{"429 without retry after", option, apiErrors.NewTooManyRequests("disruption budget", 0), 5 * time.Second},
+		{"retry after over maximum", option, apiErrors.NewTooManyRequests("disruption budget", 600), time.Minute},
+		{"retry after without maximum", EvictionOption{RetryInterval: 5 * time.Second}, apiErrors.NewTooManyRequests("disruption budget", 600), 10 * time.Minute},
+		{"500", option, apiErrors.NewInternalError(errors.New("internal")), 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evictionRetryInterval(tt.option, tt.err); got != tt.want {
+				t.Errorf("unexpected interval: got=%s, want=%s", got, tt.want)
+			}
+		})
+	}
+}
+
+//
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "unavailable"), true},
+		{"grpc resource exhausted", status.Error(codes.ResourceExhausted, "quota"), true},
+		{"grpc aborted", status.Error(codes.Aborted, "aborted"), true},
+		{"grpc deadline exceeded", status.Error(codes.DeadlineExceeded, "deadline"), true},
+		{"grpc internal", status.Error(codes.Internal, "internal"), true},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "invalid"), false},
+		{"grpc not found", status.Error(codes.NotFound, "not found"), false},
+		{"googleapi 429", &googleapi.Error{Code: 429}, true},
+		{"googleapi 500", &googleapi.Error{Code: 500}, true},
+		{"googleapi 502", &googleapi.Error{Code: 502}, true},
+		{"googleapi 503", &googleapi.Error{Code: 503}, true},
+		{"googleapi 504", &googleapi.Error{Code: 504}, true},
+		{"googleapi wrapped 503", fmt.Errorf("wrapped: %w", &googleapi.Error{Code: 503}), true},
+		{"googleapi 403", &googleapi.Error{Code: 403}, false},
+		{"googleapi 404", &googleapi.Error{Code: 404}, false},
+		{"kubernetes 429", apiErrors.NewTooManyRequests("too many requests", 0), true},
+		{"kubernetes 409", apiErrors.NewConflict(schema.GroupResource{Resource: "nodes"}, "node", errors.New("conflict")), true},
+		{"kubernetes 500", apiErrors.NewInternalError(errors.New("internal")), true},
+		{"kubernetes 503", apiErrors.NewServiceUnavailable("unavailable"), true},
+		{"kubernetes 504", apiErrors.NewTimeoutError("timeout", 0), true},
+		{"kubernetes 403", apiErrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "node", errors.New("denied")), false},
+		{"kubernetes 404", apiErrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node"), false},
+		{"unknown", errors.New("unknown"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("unexpected retryable: got=%t, want=%t", got, tt.want)
+			}
+		})
+	}
+}
+
+//
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		option   RetryOption
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first", RetryOption{InitialInterval: time.Second, MaxInterval: time.Minute}, 1, 500 * time.Millisecond, time.Second},
+		{"exponential", RetryOption{InitialInterval: time.Second, MaxInterval: time.Minute}, 3, 2 * time.Second, 4 * time.Second},
+		{"maximum", RetryOption{InitialInterval: time.Second, MaxInterval: 5 * time.Second}, 10, 2500 * time.Millisecond, 5 * time.Second},
+		{"zero", RetryOption{}, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := backoff(tt.option, tt.attempt); got < tt.min || got > tt.max {
+					t.Fatalf("unexpected interval: got=%s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+//
+func TestRetryGivesUpBeforeDeadline(t *testing.T) {
+	cli := &client{option: ClientOption{Retry: RetryOption{MaxAttempts: 3, InitialInterval: time.Minute, MaxInterval: time.Minute}}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	calls := 0
+	err := cli.retry(ctx, "Evict", func(ctx context.Context) error {
+		calls++
+		return apiErrors.NewTooManyRequests("disruption budget", 0)
+	})
+	if calls != 1 {
+		t.Errorf("unexpected calls: got=%d, want=1", calls)
+	}
+	if !apiErrors.IsTooManyRequests(err) {
+		t.Errorf("error type is lost: %v", err)
+	}
+	if outcome, _ := classifyEviction(err); outcome != EvictionOutcomeBlocked {
+		t.Errorf("unexpected outcome: got=%s, want=%s", outcome, EvictionOutcomeBlocked)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("retry waited until the deadline")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/na-ga/gke-node-optimizer/log"
+	"github.com/na-ga/gke-node-optimizer/tracing"
 
 	containerV1 "cloud.google.com/go/container/apiv1"
 	"golang.org/x/oauth2/google"
@@ -18,6 +19,7 @@ import (
 	policyV1beta1 "k8s.io/api/policy/v1beta1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -34,8 +36,20 @@ const (
 	ResourceEvictionKind = "Eviction"
 	ResourceEvictionName = "pods/eviction"
 	NodeNameMaxLength    = 37
+	PodListPageSize      = 500
+	NodePollInterval     = 15 * time.Second
+	PodPollInterval      = 5 * time.Second
+	CordonedAtAnnotation = "gke-node-optimizer/cordoned-at"
 )
 
+// DrainHook is called around the drain of a node.
+type DrainHook interface {
+	// BeforeDrain is called after the cordon, and the drain is canceled if it returns the error.
+	BeforeDrain(ctx context.Context, node *Node) error
+	// AfterDrain is called after the drain with the evictions and the error of the drain.
+	AfterDrain(ctx context.Context, node *Node, evictions []*Eviction, err error)
+}
+
 //
 type Client interface {
 	// GetCluster returns the owned cluster.
@@ -44,6 +58,8 @@ type Client interface {
 	GetNodePool(ctx context.Context, nodePoolName string) (*NodePool, error)
 	// GetNodePoolList returns the node pool list by the owned cluster.
 	GetNodePoolList(ctx context.Context) ([]*NodePool, error)
+	// GetRunningOperationList returns the pending or running operations which target the owned cluster or its node pools.
+	GetRunningOperationList(ctx context.Context) ([]*Operation, error)
 	// GetNode returns the node by the node name.
 	GetNode(ctx context.Context, nodeName string) (*Node, error)
 	// GetNodeList returns the nodes into the owned cluster.
@@ -53,9 +69,42 @@ type Client interface {
 	// GetPodListByNodeName returns the pod list by the node name.
 	GetPodListByNodeName(ctx context.Context, nodeName string) ([]*Pod, error)
 	// RefreshNode drains node and deletes node if preemptible.
-	RefreshNode(ctx context.Context, nodeName string) (evictedPods []*Pod, err error)
+	RefreshNode(ctx context.Context, nodeName string) (evictions []*Eviction, err error)
 	// RefreshNodes drains nodes and deletes nodes if preemptible.
-	RefreshNodes(ctx context.Context, nodeNames []string) (evictedPods []*Pod, err error)
+	RefreshNodes(ctx context.Context, nodeNames []string) (evictions []*Eviction, err error)
+	// DrainNode cordons and drains node, and leaves it cordoned. It uncordons node if failed.
+	DrainNode(ctx context.Context, nodeName string) (evictions []*Eviction, err error)
+	// EvacuateNode cordons and drains the node which is going to be terminated, without the pre-drain period and the rollback.
+	EvacuateNode(ctx context.Context, nodeName string) (evictions []*Eviction, err error)
+	// UncordonManagedNodes uncordons all nodes cordoned by the optimizer, and returns the names of them.
+	UncordonManagedNodes(ctx context.Context) (nodeNames []string, err error)
+	// WaitForReplacementNode waits until the node pool has the expected number of ready nodes including a node created after since,
+	// and returns the newest node. It returns the error if the timeout is exceeded.
+	WaitForReplacementNode(ctx context.Context, nodePoolName string, expectedCount int, since time.Time, timeout time.Duration) (*Node, error)
+	// Sync waits for the cache to be synced, and takes the snapshot which GetNodeList reads until the next sync.
+	// It does nothing if the cache is not used.
+	Sync(ctx context.Context) error
+	// RecordSummaryEvent records the summary event to the job and the cronjob which owns the running pod.
+	RecordSummaryEvent(ctx context.Context, failed bool, message string) error
+}
+
+//
+type ClientOption struct {
+	UseLocalConfig bool
+	RecordEvents   bool
+	Retry          RetryOption
+	UseCache       bool
+	CacheResync    time.Duration
+	Eviction       EvictionOption
+	// PreDrainTaint is the taint added to the target nodes the pre-drain period before the drain, or nil to disable.
+	PreDrainTaint  *coreV1.Taint
+	PreDrainPeriod time.Duration
+	// DrainHook is called before and after the drain of each node, or nil to disable.
+	DrainHook DrainHook
+	// CleanupTimeout is the maximum time to uncordon nodes after the context is canceled.
+	CleanupTimeout time.Duration
+	// Disruption is the policy of the running jobs and the pods annotated not to be disrupted.
+	Disruption DisruptionOption
 }
 
 //
@@ -64,8 +113,11 @@ type client struct {
 	clusterName      string
 	clusterLocation  string
 	clusterManager   *containerV1.ClusterManagerClient
-	kubernetesClient *kubernetes.Clientset
+	kubernetesClient kubernetes.Interface
 	computeClient    *computeV1.Service
+	option           ClientOption
+	cache            *Cache
+	snapshot         *Snapshot
 }
 
 //
@@ -82,16 +134,32 @@ type NodePool struct {
 	Name              string
 	ResourceURL       string
 	Preemptible       bool
+	MachineType       string
 	Autoscale         bool
 	MinNodeCount      int
 	MaxNodeCount      int
 	Status            containerProtoV1.NodePool_Status
+	StatusMessage     string
+	Version           string
+	MaxSurge          int
+	MaxUnavailable    int
 	InstanceGroupURLs []string
 }
 
+//
+type Operation struct {
+	Name      string
+	Type      containerProtoV1.Operation_Type
+	Status    containerProtoV1.Operation_Status
+	NodePool  string
+	Detail    string
+	StartTime string
+}
+
 //
 type Node struct {
 	Name        string
+	UID         string
 	ResourceURL string
 	ClusterName string
 	NodePool    string
@@ -101,19 +169,45 @@ type Node struct {
 	Preemptible bool
 	Age         time.Duration
 	Pods        []*Pod
+	// PreDrainTaint is the taint added by the optimizer, which is left if the optimizer stopped abnormally.
+	PreDrainTaint string
+	// Allocatable is the resources of the node available for the pods.
+	Allocatable Resources
+	Labels      map[string]string
+	Taints      []coreV1.Taint
+	// NotReadyAt is the time when the node became not ready since the previous run in daemon mode, even if it is ready again.
+	NotReadyAt time.Time
 }
 
 //
 type Pod struct {
 	Name      string
+	UID       string
 	Namespace string
 	NodeName  string
 	Hostname  string
 	Status    coreV1.PodStatus
+	// OwnerKind and OwnerName are the controller of the pod, such as Deployment, StatefulSet, DaemonSet, Job or Node for the static pod.
+	// The ReplicaSet of the Deployment is resolved to the Deployment. Both are empty for the bare pod.
+	OwnerKind         string
+	OwnerName         string
+	PriorityClassName string
+	Priority          int32
+	QOSClass          coreV1.PodQOSClass
+	// Requests is the resources requested by the pod to be scheduled.
+	Requests Resources
+	Limits   Resources
+	Volumes  []Volume
+	// Annotations is the annotations relevant to the drain, such as safe-to-evict of the cluster autoscaler.
+	Annotations  map[string]string
+	NodeSelector map[string]string
+	Tolerations  []coreV1.Toleration
+	// RequiredNodeAffinity is the node affinity required during scheduling, or nil.
+	RequiredNodeAffinity *coreV1.NodeSelector
 }
 
 //
-func New(ctx context.Context, project, clusterName, clusterLocation string, useLocalConfig bool) (Client, error) {
+func New(ctx context.Context, project, clusterName, clusterLocation string, option ClientOption) (Client, error) {
 	cli, err := google.DefaultClient(ctx, computeV1.ComputeScope)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create google default client: %s", err)
@@ -126,7 +220,29 @@ func New(ctx context.Context, project, clusterName, clusterLocation string, useL
 	if err != nil {
 		return nil, err
 	}
+	kubernetesClient, err := NewKubernetesClient(option.UseLocalConfig)
+	if err != nil {
+		return nil, err
+	}
+	ret := &client{
+		project:          project,
+		clusterName:      clusterName,
+		clusterLocation:  clusterLocation,
+		computeClient:    computeClient,
+		kubernetesClient: kubernetesClient,
+		clusterManager:   clusterManager,
+		option:           option,
+	}
+	if option.UseCache {
+		ret.cache = NewCache(kubernetesClient, option.CacheResync)
+	}
+	return ret, nil
+}
+
+// NewKubernetesClient returns the kubernetes client by the local kube config or the in-cluster config.
+func NewKubernetesClient(useLocalConfig bool) (kubernetes.Interface, error) {
 	var kubernetesConfig *rest.Config
+	var err error
 	if useLocalConfig {
 		kubernetesConfig, err = clientcmd.BuildConfigFromFlags("", filepath.Join(os.Getenv("HOME"), ".kube", "config"))
 	} else {
@@ -139,22 +255,20 @@ func New(ctx context.Context, project, clusterName, clusterLocation string, useL
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %s", err)
 	}
-	ret := &client{
-		project:          project,
-		clusterName:      clusterName,
-		clusterLocation:  clusterLocation,
-		computeClient:    computeClient,
-		kubernetesClient: kubernetesClient,
-		clusterManager:   clusterManager,
-	}
-	return ret, nil
+	return kubernetesClient, nil
 }
 
 //
-func (cli *client) GetCluster(ctx context.Context) (*Cluster, error) {
+func (cli *client) GetCluster(ctx context.Context) (_ *Cluster, err error) {
+	ctx, span := tracing.Start(ctx, "GetCluster")
+	defer func() { tracing.End(span, err) }()
 	name := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", cli.project, cli.clusterLocation, cli.clusterName)
 	req := &containerProtoV1.GetClusterRequest{Name: name}
-	res, err := cli.clusterManager.GetCluster(ctx, req)
+	var res *containerProtoV1.Cluster
+	err = cli.retry(ctx, "GetCluster", func(ctx context.Context) (err error) {
+		res, err = cli.clusterManager.GetCluster(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cluster %s: %s", name, err)
 	}
@@ -172,7 +286,11 @@ func (cli *client) GetCluster(ctx context.Context) (*Cluster, error) {
 func (cli *client) GetNodePool(ctx context.Context, nodePoolName string) (*NodePool, error) {
 	name := fmt.Sprintf("projects/%s/locations/%s/clusters/%s/nodePools/%s", cli.project, cli.clusterLocation, cli.clusterName, nodePoolName)
 	req := &containerProtoV1.GetNodePoolRequest{Name: name}
-	res, err := cli.clusterManager.GetNodePool(ctx, req)
+	var res *containerProtoV1.NodePool
+	err := cli.retry(ctx, "GetNodePool", func(ctx context.Context) (err error) {
+		res, err = cli.clusterManager.GetNodePool(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node pool %s: %s", name, err)
 	}
@@ -183,16 +301,64 @@ func (cli *client) GetNodePool(ctx context.Context, nodePoolName string) (*NodeP
 func (cli *client) GetNodePoolList(ctx context.Context) ([]*NodePool, error) {
 	parent := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", cli.project, cli.clusterLocation, cli.clusterName)
 	req := &containerProtoV1.ListNodePoolsRequest{Parent: parent}
-	res, err := cli.clusterManager.ListNodePools(ctx, req)
+	var res *containerProtoV1.ListNodePoolsResponse
+	err := cli.retry(ctx, "ListNodePools", func(ctx context.Context) (err error) {
+		res, err = cli.clusterManager.ListNodePools(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node pool list %s: %s", parent, err)
 	}
 	return cli.toNodePools(res.NodePools), nil
 }
 
+//
+func (cli *client) GetRunningOperationList(ctx context.Context) (_ []*Operation, err error) {
+	ctx, span := tracing.Start(ctx, "GetRunningOperationList")
+	defer func() { tracing.End(span, err) }()
+	parent := fmt.Sprintf("projects/%s/locations/%s", cli.project, cli.clusterLocation)
+	req := &containerProtoV1.ListOperationsRequest{Parent: parent}
+	var res *containerProtoV1.ListOperationsResponse
+	err = cli.retry(ctx, "ListOperations", func(ctx context.Context) (err error) {
+		res, err = cli.clusterManager.ListOperations(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operation list %s: %s", parent, err)
+	}
+	clusterPath := fmt.Sprintf("/clusters/%s", cli.clusterName)
+	ret := make([]*Operation, 0, len(res.Operations))
+	for _, v := range res.Operations {
+		if v.Status != containerProtoV1.Operation_PENDING && v.Status != containerProtoV1.Operation_RUNNING && v.Status != containerProtoV1.Operation_ABORTING {
+			continue
+		}
+		idx := strings.Index(v.TargetLink, clusterPath)
+		if idx < 0 {
+			continue
+		}
+		rest := v.TargetLink[idx+len(clusterPath):]
+		if rest != "" && !strings.HasPrefix(rest, "/") {
+			continue // other cluster which has the same prefix
+		}
+		ret = append(ret, &Operation{
+			Name:      v.Name,
+			Type:      v.OperationType,
+			Status:    v.Status,
+			NodePool:  strings.TrimPrefix(rest, "/nodePools/"),
+			Detail:    v.Detail,
+			StartTime: v.StartTime,
+		})
+	}
+	return ret, nil
+}
+
 //
 func (cli *client) GetNode(ctx context.Context, nodeName string) (*Node, error) {
-	res, err := cli.kubernetesClient.CoreV1().Nodes().Get(ctx, nodeName, metaV1.GetOptions{})
+	var res *coreV1.Node
+	err := cli.retry(ctx, "GetNode", func(ctx context.Context) (err error) {
+		res, err = cli.kubernetesClient.CoreV1().Nodes().Get(ctx, nodeName, metaV1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node list: %s", err)
 	}
@@ -206,26 +372,108 @@ func (cli *client) GetNode(ctx context.Context, nodeName string) (*Node, error)
 }
 
 //
-func (cli *client) GetNodeList(ctx context.Context) ([]*Node, error) {
-	nl, err := cli.kubernetesClient.CoreV1().Nodes().List(ctx, metaV1.ListOptions{})
+func (cli *client) GetNodeList(ctx context.Context) (_ []*Node, err error) {
+	ctx, span := tracing.Start(ctx, "GetNodeList")
+	defer func() { tracing.End(span, err) }()
+	if cli.snapshot != nil {
+		return cli.toNodesFromSnapshot(cli.snapshot), nil
+	}
+	var nl *coreV1.NodeList
+	err = cli.retry(ctx, "ListNodes", func(ctx context.Context) (err error) {
+		nl, err = cli.kubernetesClient.CoreV1().Nodes().List(ctx, metaV1.ListOptions{})
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node list: %s", err)
 	}
 	nodes := cli.toNodes(nl.Items)
+	podsByNodeName, err := cli.getPodListGroupByNodeName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods on nodes: %s", err)
+	}
 	for _, v := range nodes {
-		pods, err := cli.GetPodListByNodeName(ctx, v.Name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get pods on node %s: %s", v.Name, err)
+		v.Pods = podsByNodeName[v.Name]
+		if v.Pods == nil {
+			v.Pods = make([]*Pod, 0)
 		}
-		v.Pods = pods
 	}
 	return nodes, nil
 }
 
+// getPodListGroupByNodeName lists all pods with pagination, and groups them by the node name.
+func (cli *client) getPodListGroupByNodeName(ctx context.Context) (_ map[string][]*Pod, err error) {
+	ctx, span := tracing.Start(ctx, "ListPods")
+	defer func() { tracing.End(span, err) }()
+	ret := make(map[string][]*Pod)
+	opts := metaV1.ListOptions{Limit: PodListPageSize}
+	for {
+		var pods *coreV1.PodList
+		err := cli.retry(ctx, "ListPods", func(ctx context.Context) (err error) {
+			pods, err = cli.kubernetesClient.CoreV1().Pods(metaV1.NamespaceAll).List(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("falid to get pod list: %s", err)
+		}
+		for _, v := range pods.Items {
+			if v.Spec.NodeName == "" {
+				continue // not scheduled
+			}
+			ret[v.Spec.NodeName] = append(ret[v.Spec.NodeName], cli.toPod(v))
+		}
+		if pods.Continue == "" {
+			return ret, nil
+		}
+		opts.Continue = pods.Continue
+	}
+}
+
+//
+func (cli *client) Sync(ctx context.Context) (err error) {
+	if cli.cache == nil {
+		return nil
+	}
+	ctx, span := tracing.Start(ctx, "Sync")
+	defer func() { tracing.End(span, err) }()
+	if err := cli.cache.WaitForSync(ctx); err != nil {
+		return err
+	}
+	snapshot, err := cli.cache.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to take snapshot: %s", err)
+	}
+	cli.snapshot = snapshot
+	log.Infof("Succeeded in take snapshot: nodes=%d, notReadyTransitions=%d", len(snapshot.Nodes), len(snapshot.NotReadyAt))
+	return nil
+}
+
+//
+func (cli *client) toNodesFromSnapshot(snapshot *Snapshot) []*Node {
+	out := make([]*Node, 0, len(snapshot.Nodes))
+	for _, v := range snapshot.Nodes {
+		node := cli.toNode(*v)
+		if node == nil {
+			continue
+		}
+		node.NotReadyAt = snapshot.NotReadyAt[v.Name]
+		pods := snapshot.PodsByNodeName[v.Name]
+		node.Pods = make([]*Pod, 0, len(pods))
+		for _, pod := range pods {
+			node.Pods = append(node.Pods, cli.toPod(*pod))
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
 //
 func (cli *client) GetPod(ctx context.Context, podName string) (*Pod, error) {
-	pods, err := cli.kubernetesClient.CoreV1().Pods(metaV1.NamespaceAll).List(ctx, metaV1.ListOptions{
-		FieldSelector: fields.SelectorFromSet(fields.Set{"name": podName}).String(),
+	var pods *coreV1.PodList
+	err := cli.retry(ctx, "ListPods", func(ctx context.Context) (err error) {
+		pods, err = cli.kubernetesClient.CoreV1().Pods(metaV1.NamespaceAll).List(ctx, metaV1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"name": podName}).String(),
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("falid to get pod by pod name %s: %s", podName, err)
@@ -237,9 +485,15 @@ func (cli *client) GetPod(ctx context.Context, podName string) (*Pod, error) {
 }
 
 //
-func (cli *client) GetPodListByNodeName(ctx context.Context, nodeName string) ([]*Pod, error) {
-	pods, err := cli.kubernetesClient.CoreV1().Pods(metaV1.NamespaceAll).List(ctx, metaV1.ListOptions{
-		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+func (cli *client) GetPodListByNodeName(ctx context.Context, nodeName string) (_ []*Pod, err error) {
+	ctx, span := tracing.Start(ctx, "GetPodListByNodeName", tracing.AttributeNode.String(nodeName))
+	defer func() { tracing.End(span, err) }()
+	var pods *coreV1.PodList
+	err = cli.retry(ctx, "ListPods", func(ctx context.Context) (err error) {
+		pods, err = cli.kubernetesClient.CoreV1().Pods(metaV1.NamespaceAll).List(ctx, metaV1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": nodeName}).String(),
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("falid to get pod list by node name %s: %s", nodeName, err)
@@ -248,17 +502,59 @@ func (cli *client) GetPodListByNodeName(ctx context.Context, nodeName string) ([
 }
 
 //
-func (cli *client) RefreshNode(ctx context.Context, nodeName string) (evictedPods []*Pod, err error) {
+func (cli *client) WaitForReplacementNode(ctx context.Context, nodePoolName string, expectedCount int, since time.Time, timeout time.Duration) (_ *Node, err error) {
+	ctx, span := tracing.Start(ctx, "WaitForReplacementNode", tracing.AttributePool.String(nodePoolName))
+	defer func() { tracing.End(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logger := log.WithFields(log.Fields{log.FieldPool: nodePoolName})
+	selector := metaV1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", NodePoolLabel, nodePoolName)}
+	for {
+		var nodes *coreV1.NodeList
+		err := cli.retry(ctx, "ListNodes", func(ctx context.Context) (err error) {
+			nodes, err = cli.kubernetesClient.CoreV1().Nodes().List(ctx, selector)
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to get node list of node pool %s: %s", nodePoolName, err)
+		}
+		readyCount := 0
+		var replacement *coreV1.Node
+		if nodes != nil {
+			for i, v := range nodes.Items {
+				if !isNodeReady(&v) || v.Spec.Unschedulable {
+					continue
+				}
+				readyCount++
+				if v.CreationTimestamp.Time.After(since) && (replacement == nil || v.CreationTimestamp.After(replacement.CreationTimestamp.Time)) {
+					replacement = &nodes.Items[i]
+				}
+			}
+		}
+		if replacement != nil && readyCount >= expectedCount {
+			if node := cli.toNode(*replacement); node != nil {
+				logger.Infof("Detected replacement node: name=%s, readyNodes=%d/%d", node.Name, readyCount, expectedCount)
+				return node, nil
+			}
+		}
+		logger.Infof("Waiting for replacement node of %s: readyNodes=%d/%d, replacement=%t", nodePoolName, readyCount, expectedCount, replacement != nil)
+		if err := sleep(ctx, NodePollInterval); err != nil {
+			return nil, fmt.Errorf("timed out waiting for replacement node of %s after %s: readyNodes=%d/%d, replacement=%t", nodePoolName, timeout, readyCount, expectedCount, replacement != nil)
+		}
+	}
+}
+
+//
+func (cli *client) RefreshNode(ctx context.Context, nodeName string) (evictions []*Eviction, err error) {
 	node, err := cli.GetNode(ctx, nodeName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get node %s: %s", nodeName, err)
 	}
-	if err := cli.cordonNode(ctx, node.Name); err != nil {
-		return nil, fmt.Errorf("failed to cordon node %s: %s", node.Name, err)
-	}
 	cordonNode := node
 	defer func() {
 		if cordonNode != nil {
+			ctx, cancel := cli.cleanupContext(ctx)
+			defer cancel()
 			if e := cli.uncordonNode(ctx, cordonNode.Name); e != nil {
 				if err == nil {
 					err = fmt.Errorf("failed to uncordon node %s: %s", cordonNode.Name, e)
@@ -268,22 +564,126 @@ func (cli *client) RefreshNode(ctx context.Context, nodeName string) (evictedPod
 			}
 		}
 	}()
-	evictedPods, err = cli.drainNode(ctx, node)
-	if err != nil {
+	if err := cli.preDrain(ctx, []*Node{node}); err != nil {
+		return nil, err
+	}
+	if err := cli.cordonNode(ctx, node.Name); err != nil {
+		return nil, fmt.Errorf("failed to cordon node %s: %s", node.Name, err)
+	}
+	if err := cli.waitForPodsCompleted(ctx, node); err != nil {
 		return nil, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
 	}
+	evictions, err = cli.drainNode(ctx, node, false)
+	if err != nil {
+		return evictions, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
+	}
 	if node.Preemptible {
 		cordonNode = nil // reset
 		if err := cli.deleteNode(ctx, node); err != nil {
-			return evictedPods, fmt.Errorf("failed to delete node %s: %s", node.Name, err)
+			return evictions, fmt.Errorf("failed to delete node %s: %s", node.Name, err)
+		}
+		log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool}).Infof("Succeeded in stop instance: %s", node.Name)
+	}
+	return evictions, nil
+}
+
+//
+func (cli *client) DrainNode(ctx context.Context, nodeName string) (evictions []*Eviction, err error) {
+	node, err := cli.GetNode(ctx, nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %s", nodeName, err)
+	}
+	defer func() {
+		if err == nil {
+			return // leave the node cordoned
+		}
+		ctx, cancel := cli.cleanupContext(ctx)
+		defer cancel()
+		if e := cli.uncordonNode(ctx, node.Name); e != nil {
+			err = fmt.Errorf("failed to uncordon node %s: %s: %s", node.Name, e, err)
+		}
+	}()
+	if err := cli.preDrain(ctx, []*Node{node}); err != nil {
+		return nil, err
+	}
+	if err := cli.cordonNode(ctx, node.Name); err != nil {
+		return nil, fmt.Errorf("failed to cordon node %s: %s", node.Name, err)
+	}
+	if err := cli.waitForPodsCompleted(ctx, node); err != nil {
+		return nil, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
+	}
+	evictions, err = cli.drainNode(ctx, node, false)
+	if err != nil {
+		return evictions, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
+	}
+	return evictions, nil
+}
+
+//
+func (cli *client) UncordonManagedNodes(ctx context.Context) (nodeNames []string, err error) {
+	var nodes *coreV1.NodeList
+	err = cli.retry(ctx, "ListNodes", func(ctx context.Context) (err error) {
+		nodes, err = cli.kubernetesClient.CoreV1().Nodes().List(ctx, metaV1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node list: %s", err)
+	}
+	nodeNames = make([]string, 0, len(nodes.Items))
+	for _, v := range nodes.Items {
+		_, cordoned := v.Annotations[CordonedAtAnnotation]
+		_, tainted := v.Annotations[PreDrainTaintAnnotation]
+		if !cordoned && !tainted {
+			continue
+		}
+		if err := cli.uncordonNode(ctx, v.Name); err != nil {
+			return nodeNames, fmt.Errorf("failed to uncordon node %s: %s", v.Name, err)
 		}
-		log.Infof("Succeeded in stop instance: %s", node.Name)
+		nodeNames = append(nodeNames, v.Name)
 	}
-	return evictedPods, nil
+	return nodeNames, nil
 }
 
 //
-func (cli *client) RefreshNodes(ctx context.Context, nodeNames []string) (evictedPods []*Pod, err error) {
+func (cli *client) EvacuateNode(ctx context.Context, nodeName string) (evictions []*Eviction, err error) {
+	ctx, span := tracing.Start(ctx, "EvacuateNode", tracing.AttributeNode.String(nodeName))
+	defer func() { tracing.End(span, err) }()
+	node, err := cli.GetNode(ctx, nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %s", nodeName, err)
+	}
+	if err := cli.cordonNode(ctx, node.Name); err != nil {
+		return nil, fmt.Errorf("failed to cordon node %s: %s", node.Name, err)
+	}
+	if namespace, name, ok := selfPod(); ok {
+		pods := make([]*Pod, 0, len(node.Pods))
+		for _, v := range node.Pods {
+			if v.Namespace != namespace || v.Name != name {
+				pods = append(pods, v) // the running pod is terminated with the node
+			}
+		}
+		node.Pods = pods
+	}
+	evictions, err = cli.drainNode(ctx, node, true)
+	if err != nil {
+		return evictions, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
+	}
+	return evictions, nil
+}
+
+// cleanupContext returns the context to roll back, which is not canceled with the given context but times out.
+func (cli *client) cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return context.WithCancel(ctx)
+	}
+	log.Warnf("Roll back within %s because canceled: %s", cli.option.CleanupTimeout, ctx.Err())
+	return context.WithTimeout(tracing.Detach(ctx), cli.option.CleanupTimeout)
+}
+
+//
+func (cli *client) RefreshNodes(ctx context.Context, nodeNames []string) (evictions []*Eviction, err error) {
+	ctx, span := tracing.Start(ctx, "RefreshNodes")
+	defer func() { tracing.End(span, err) }()
 	nodes := make([]*Node, 0, len(nodeNames))
 	for _, v := range nodeNames {
 		node, err := cli.GetNode(ctx, v)
@@ -294,6 +694,8 @@ func (cli *client) RefreshNodes(ctx context.Context, nodeNames []string) (evicte
 	}
 	cordonNodes := make(map[string]*Node, len(nodes))
 	defer func() {
+		ctx, cancel := cli.cleanupContext(ctx)
+		defer cancel()
 		for _, node := range cordonNodes {
 			if e := cli.uncordonNode(ctx, node.Name); e != nil {
 				if err == nil {
@@ -304,35 +706,41 @@ func (cli *client) RefreshNodes(ctx context.Context, nodeNames []string) (evicte
 			}
 		}
 	}()
+	for _, node := range nodes {
+		cordonNodes[node.Name] = node // roll back the pre-drain taints too
+	}
+	if err := cli.preDrain(ctx, nodes); err != nil {
+		return nil, err
+	}
 	for _, node := range nodes {
 		if err := cli.cordonNode(ctx, node.Name); err != nil {
 			return nil, fmt.Errorf("failed to cordon node %s: %s", node.Name, err)
 		}
-		cordonNodes[node.Name] = node
 	}
-	evictedPods = make([]*Pod, 0, len(nodes)*32) // maximum pods per node default value is 32
+	evictions = make([]*Eviction, 0, len(nodes)*32) // maximum pods per node default value is 32
 	for i, node := range nodes {
 		if i > 0 {
-			log.Infof("Waiting 1 minute for evicted pods on %s to running.", nodes[i-1].Name)
-			time.Sleep(time.Minute)
+			log.WithFields(log.Fields{log.FieldNode: nodes[i-1].Name}).Infof("Waiting 1 minute for evicted pods on %s to running.", nodes[i-1].Name)
+			if err := sleep(ctx, time.Minute); err != nil {
+				return evictions, fmt.Errorf("aborted before drain node %s: %s", node.Name, err)
+			}
 		}
-		pods, err := cli.drainNode(ctx, node)
-		evictedPods = append(evictedPods, pods...)
+		if err := cli.waitForPodsCompleted(ctx, node); err != nil {
+			return evictions, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
+		}
+		v, err := cli.drainNode(ctx, node, false)
+		evictions = append(evictions, v...)
 		if err != nil {
-			return evictedPods, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
+			return evictions, fmt.Errorf("failed to drain node %s: %s", node.Name, err)
 		}
 		if node.Preemptible {
 			if err := cli.deleteNode(ctx, node); err != nil {
-				return evictedPods, fmt.Errorf("failed to delete node %s: %s", node.Name, err)
-			}
-			delete(cordonNodes, node.Name) // reset
-			if _, err := cli.computeClient.Instances.Stop(cli.project, node.Zone, node.Name).Context(ctx).Do(); err != nil {
-				return evictedPods, fmt.Errorf("failed to stop instance %s: %s", node.Name, err)
+				return evictions, fmt.Errorf("failed to delete node %s: %s", node.Name, err)
 			}
-			log.Infof("Succeeded in stop instance: %s", node.Name)
+			delete(cordonNodes, node.Name) // reset, and the instance is stopped by deleteNode
 		}
 	}
-	return evictedPods, nil
+	return evictions, nil
 }
 
 //
@@ -352,6 +760,11 @@ func (cli *client) toNodePool(in *containerProtoV1.NodePool) *NodePool {
 		minNodeCount = int(in.Autoscaling.MinNodeCount)
 		maxNodeCount = int(in.Autoscaling.MaxNodeCount)
 	}
+	var maxSurge, maxUnavailable int
+	if in.UpgradeSettings != nil {
+		maxSurge = int(in.UpgradeSettings.MaxSurge)
+		maxUnavailable = int(in.UpgradeSettings.MaxUnavailable)
+	}
 	return &NodePool{
 		Name:              in.Name,
 		ResourceURL:       fmt.Sprintf("https://console.cloud.google.com/kubernetes/nodepool/%s/%s/%s?project=%s", cli.clusterLocation, cli.clusterName, in.Name, cli.project),
@@ -360,7 +773,12 @@ func (cli *client) toNodePool(in *containerProtoV1.NodePool) *NodePool {
 		MaxNodeCount:      maxNodeCount,
 		InstanceGroupURLs: in.InstanceGroupUrls,
 		Preemptible:       in.Config.Preemptible,
+		MachineType:       in.Config.MachineType,
 		Status:            in.Status,
+		StatusMessage:     in.StatusMessage,
+		Version:           in.Version,
+		MaxSurge:          maxSurge,
+		MaxUnavailable:    maxUnavailable,
 	}
 }
 
@@ -380,7 +798,7 @@ func (cli *client) toNode(in coreV1.Node) *Node {
 	labels := in.Labels
 	pool, ok := labels[NodePoolLabel]
 	if !ok {
-		log.Errorf("Ignore node because label %s is not exists: name=%s", NodePoolLabel, in.Name)
+		log.WithFields(log.Fields{log.FieldNode: in.Name}).Errorf("Ignore node because label %s is not exists: name=%s", NodePoolLabel, in.Name)
 		return nil
 	}
 	nodeNamePrefix := "gke-" + cli.clusterName + "-" + pool
@@ -388,17 +806,17 @@ func (cli *client) toNode(in coreV1.Node) *Node {
 		nodeNamePrefix = nodeNamePrefix[:NodeNameMaxLength]
 	}
 	if cli.clusterName != "" && !strings.HasPrefix(in.Name, nodeNamePrefix) { // n.ClusterName is empty string
-		log.Errorf("Ignore node because unexpected node name prefix: name=%s, prefix=%s", in.Name, nodeNamePrefix)
+		log.WithFields(log.Fields{log.FieldNode: in.Name}).Errorf("Ignore node because unexpected node name prefix: name=%s, prefix=%s", in.Name, nodeNamePrefix)
 		return nil
 	}
 	region, ok := labels[NodeRegionLabel]
 	if !ok {
-		log.Errorf("Ignore node because label %s is not exists: name=%s", NodeRegionLabel, in.Name)
+		log.WithFields(log.Fields{log.FieldNode: in.Name}).Errorf("Ignore node because label %s is not exists: name=%s", NodeRegionLabel, in.Name)
 		return nil
 	}
 	zone, ok := labels[NodeZoneLabel]
 	if !ok {
-		log.Errorf("Ignore node because label %s is not exists: name=%s", NodeZoneLabel, in.Name)
+		log.WithFields(log.Fields{log.FieldNode: in.Name}).Errorf("Ignore node because label %s is not exists: name=%s", NodeZoneLabel, in.Name)
 		return nil
 	}
 	ready := false
@@ -409,15 +827,20 @@ func (cli *client) toNode(in coreV1.Node) *Node {
 		}
 	}
 	return &Node{
-		ClusterName: cli.clusterName, // not use `n.ClusterName` because always empty string
-		Name:        in.Name,
-		ResourceURL: fmt.Sprintf("https://console.cloud.google.com/kubernetes/node/%s/%s/%s?project=%s", region, cli.clusterName, in.Name, cli.project),
-		NodePool:    pool,
-		Region:      region,
-		Zone:        zone,
-		Age:         time.Now().Sub(in.CreationTimestamp.Time),
-		Ready:       ready,
-		Preemptible: labels[PreemptibleLabel] == "true",
+		ClusterName:   cli.clusterName, // not use `n.ClusterName` because always empty string
+		Name:          in.Name,
+		UID:           string(in.UID),
+		ResourceURL:   fmt.Sprintf("https://console.cloud.google.com/kubernetes/node/%s/%s/%s?project=%s", region, cli.clusterName, in.Name, cli.project),
+		NodePool:      pool,
+		Region:        region,
+		Zone:          zone,
+		Age:           time.Now().Sub(in.CreationTimestamp.Time),
+		Ready:         ready,
+		Preemptible:   labels[PreemptibleLabel] == "true",
+		PreDrainTaint: in.Annotations[PreDrainTaintAnnotation],
+		Allocatable:   newResources(in.Status.Allocatable),
+		Labels:        labels,
+		Taints:        in.Spec.Taints,
 	}
 }
 
@@ -432,22 +855,52 @@ func (cli *client) toPods(in []coreV1.Pod) []*Pod {
 
 //
 func (cli *client) toPod(in coreV1.Pod) *Pod {
+	ownerKind, ownerName := podOwner(in)
+	var priority int32
+	if in.Spec.Priority != nil {
+		priority = *in.Spec.Priority
+	}
 	return &Pod{
-		Name:      in.Name,
-		Namespace: in.Namespace,
-		NodeName:  in.Spec.NodeName,
-		Hostname:  in.Spec.Hostname,
-		Status:    in.Status,
+		Name:                 in.Name,
+		UID:                  string(in.UID),
+		Namespace:            in.Namespace,
+		NodeName:             in.Spec.NodeName,
+		Hostname:             in.Spec.Hostname,
+		Status:               in.Status,
+		OwnerKind:            ownerKind,
+		OwnerName:            ownerName,
+		PriorityClassName:    in.Spec.PriorityClassName,
+		Priority:             priority,
+		QOSClass:             in.Status.QOSClass,
+		Requests:             podRequests(in.Spec),
+		Limits:               podLimits(in.Spec),
+		Volumes:              podVolumes(in.Spec),
+		Annotations:          podAnnotations(in.Annotations),
+		NodeSelector:         in.Spec.NodeSelector,
+		Tolerations:          in.Spec.Tolerations,
+		RequiredNodeAffinity: requiredNodeAffinity(in.Spec.Affinity),
 	}
 }
 
-//
-func (cli *client) drainNode(ctx context.Context, node *Node) ([]*Pod, error) {
+// drainNode evicts the pods of the cordoned node between the drain hooks.
+// The urgent drain does not wait for the workloads to be ready between the evictions, such as on the termination notice.
+func (cli *client) drainNode(ctx context.Context, node *Node, urgent bool) (_ []*Eviction, err error) {
+	ctx, span := tracing.Start(ctx, "DrainNode", tracing.AttributeNode.String(node.Name), tracing.AttributePool.String(node.NodePool))
+	defer func() { tracing.End(span, err) }()
 	policy, err := cli.policyVersion()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get policy version of node %s: %s", node.Name, err)
 	}
-	return cli.evictPods(ctx, node, policy)
+	hook := cli.option.DrainHook
+	if hook == nil {
+		return cli.evictPods(ctx, node, policy, urgent)
+	}
+	if err := hook.BeforeDrain(ctx, node); err != nil {
+		return nil, fmt.Errorf("vetoed by pre-drain hook: %s", err)
+	}
+	evictions, err := cli.evictPods(ctx, node, policy, urgent)
+	hook.AfterDrain(ctx, node, evictions, err)
+	return evictions, err
 }
 
 //
@@ -471,8 +924,7 @@ func (cli *client) policyVersion() (string, error) {
 	}
 	resourceList, err := discoveryClient.ServerResourcesForGroupVersion("v1")
 	if err != nil {
-		fmt.Errorf("failed to get server resource for group verison v1: %s", err)
-		return "", err
+		return "", fmt.Errorf("failed to get server resource for group verison v1: %s", err)
 	}
 	for _, resource := range resourceList.APIResources {
 		if resource.Name == ResourceEvictionName && resource.Kind == ResourceEvictionKind {
@@ -493,31 +945,84 @@ func (cli *client) uncordonNode(ctx context.Context, nodeName string) error {
 }
 
 //
-func (cli *client) applyCordonOrUncordon(ctx context.Context, nodeName string, cordon bool) error {
+func (cli *client) applyCordonOrUncordon(ctx context.Context, nodeName string, cordon bool) (err error) {
 	status := "cordon"
+	spanName := "CordonNode"
 	if !cordon {
 		status = "uncordon"
+		spanName = "UncordonNode"
 	}
-	n, err := cli.kubernetesClient.CoreV1().Nodes().Get(ctx, nodeName, metaV1.GetOptions{})
+	ctx, span := tracing.Start(ctx, spanName, tracing.AttributeNode.String(nodeName))
+	defer func() { tracing.End(span, err) }()
+	var n *coreV1.Node
+	updated := false
+	err = cli.retry(ctx, spanName, func(ctx context.Context) (err error) {
+		n, err = cli.kubernetesClient.CoreV1().Nodes().Get(ctx, nodeName, metaV1.GetOptions{}) // re-read on conflict
+		if err != nil {
+			return err
+		}
+		_, cordoned := n.Annotations[CordonedAtAnnotation]
+		_, tainted := n.Annotations[PreDrainTaintAnnotation]
+		if n.Spec.Unschedulable == cordon && (cordon || !(cordoned || tainted)) {
+			return nil
+		}
+		n.Spec.Unschedulable = cordon
+		if cordon {
+			if n.Annotations == nil {
+				n.Annotations = make(map[string]string, 1)
+			}
+			n.Annotations[CordonedAtAnnotation] = time.Now().Format(time.RFC3339) // mark to uncordon by the optimizer later
+		} else {
+			delete(n.Annotations, CordonedAtAnnotation)
+			removePreDrainTaint(n) // remove the pre-drain taint with the uncordon
+		}
+		if _, err = cli.kubernetesClient.CoreV1().Nodes().Update(ctx, n, metaV1.UpdateOptions{}); err != nil {
+			return err
+		}
+		updated = true
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	if n.Spec.Unschedulable == cordon {
-		log.Infof("Already %s: %s\n", status, nodeName)
+	if !updated {
+		log.WithFields(log.Fields{log.FieldNode: nodeName}).Infof("Already %s: %s", status, nodeName)
 		return nil // returns not error
 	}
-	n.Spec.Unschedulable = cordon
-	if _, err = cli.kubernetesClient.CoreV1().Nodes().Update(ctx, n, metaV1.UpdateOptions{}); err != nil {
-		return err
+	log.WithFields(log.Fields{log.FieldNode: nodeName}).Infof("Succeeded in %s node: %s", status, nodeName)
+	reason := EventReasonCordon
+	if !cordon {
+		reason = EventReasonUncordon
 	}
-	log.Infof("Succeeded in %s node: %s", status, nodeName)
+	cli.recordEvent(ctx, nodeReference(n.Name, n.UID), coreV1.EventTypeNormal, reason, fmt.Sprintf("Node %s by %s", status, EventComponent))
 	return err
 }
 
-//
-func (cli *client) evictPods(ctx context.Context, node *Node, policy string) ([]*Pod, error) {
-	evicted := make([]*Pod, 0, len(node.Pods))
-	for _, pod := range node.Pods {
+// evictPods evicts the pods of the node in the lowest priority first.
+// Unless urgent, the next pod of the stateful set is evicted after the previous one is ready again,
+// and the deployment which has only one replica is restarted instead if allowed.
+func (cli *client) evictPods(ctx context.Context, node *Node, policy string, urgent bool) ([]*Eviction, error) {
+	evictions := make([]*Eviction, 0, len(node.Pods))
+	evictedStatefulSets := make(map[string]*Pod)
+	for _, pod := range evictionOrder(node.Pods) {
+		logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool, log.FieldPod: pod.Name, log.FieldNamespace: pod.Namespace})
+		if prev, ok := evictedStatefulSets[workloadKey(pod)]; ok && !urgent && cli.option.Eviction.ReadinessTimeout > 0 {
+			if err := cli.waitForPodReplaced(ctx, node, prev); err != nil {
+				return evictions, err
+			}
+		}
+		if pod.OwnerKind == "Deployment" && !urgent && cli.option.Eviction.RestartSingleReplica && cli.option.Eviction.ReadinessTimeout > 0 {
+			restarted, err := cli.restartDeployment(ctx, node, pod)
+			if err != nil {
+				return evictions, err
+			}
+			if restarted {
+				evictions = append(evictions, &Eviction{Pod: pod, Outcome: EvictionOutcomeRestarted, Attempts: 1})
+				message := fmt.Sprintf("Restarted deployment %s by %s to refresh node %s", pod.OwnerName, EventComponent, node.Name)
+				cli.recordEvent(ctx, podReference(pod), coreV1.EventTypeNormal, EventReasonRestart, message)
+				continue
+			}
+		}
 		eviction := &policyV1beta1.Eviction{
 			TypeMeta: metaV1.TypeMeta{
 				APIVersion: policy,
@@ -528,41 +1033,101 @@ func (cli *client) evictPods(ctx context.Context, node *Node, policy string) ([]
 				Namespace: pod.Namespace,
 			},
 		}
-		for i := 1; true; i++ {
-			err := cli.kubernetesClient.PolicyV1beta1().Evictions(eviction.Namespace).Evict(ctx, eviction)
-			if err == nil {
+		if v := cli.option.Eviction.gracePeriodSeconds(); v != nil {
+			eviction.DeleteOptions = &metaV1.DeleteOptions{GracePeriodSeconds: v}
+		}
+		result := &Eviction{Pod: pod}
+		evictions = append(evictions, result)
+		for result.Attempts = 1; ; result.Attempts++ {
+			result.Err = cli.evictPod(ctx, eviction, result.Attempts)
+			outcome, retryable := classifyEviction(result.Err)
+			result.Outcome = outcome
+			if result.Err == nil || !retryable || result.Attempts >= cli.option.Eviction.MaxAttempts {
 				break
 			}
-			if err.Error() != "Cannot evict pod as it would violate the pod's disruption budget." {
-				return evicted, fmt.Errorf("failed to evict pod %s. count=%d: %s", pod.Name, i, err)
-			}
-			if i > 2 {
-				return evicted, fmt.Errorf("failed to evict pod %s because give up. count=%d: %s", pod.Name, i, err)
+			interval := evictionRetryInterval(cli.option.Eviction, result.Err)
+			logger.Warnf("Waiting %s for evicted pod to running %s (outcome=%s). count=%d: %s", interval, pod.Name, outcome, result.Attempts, result.Err)
+			if err := sleep(ctx, interval); err != nil {
+				result.Outcome = EvictionOutcomeAborted
+				result.Err = err
+				break
 			}
-			log.Warnf("Waiting 30 seconds for evicted pod to running %s. count=%d: %s", pod.Name, i, err)
-			time.Sleep(time.Second * 30)
 		}
-		evicted = append(evicted, pod)
-		log.Infof("Succeeded in evicted pod %s on node %s", pod.Name, pod.NodeName)
+		if result.Outcome == EvictionOutcomeNotFound {
+			logger.Infof("Skipped eviction of pod %s because it has already gone", pod.Name)
+			result.Err = nil
+			continue
+		}
+		if result.Outcome == EvictionOutcomeBlocked && cli.option.Eviction.canForceDelete(pod.Namespace) {
+			cli.forceDeletePod(ctx, node, result, cli.option.Eviction.gracePeriodSeconds())
+		}
+		if !result.Succeeded() {
+			return evictions, &EvictionError{Eviction: result}
+		}
+		if pod.OwnerKind == "StatefulSet" {
+			evictedStatefulSets[workloadKey(pod)] = pod
+		}
+		if result.Outcome == EvictionOutcomeForceDeleted {
+			continue
+		}
+		logger.Infof("Succeeded in evicted pod %s on node %s", pod.Name, pod.NodeName)
+		message := fmt.Sprintf("Evicted by %s to refresh node %s", EventComponent, node.Name)
+		cli.recordEvent(ctx, podReference(pod), coreV1.EventTypeNormal, EventReasonEvict, message)
+		cli.recordEvent(ctx, nodeReference(node.Name, types.UID(node.UID)), coreV1.EventTypeNormal, EventReasonEvict, fmt.Sprintf("Pod %s/%s evicted by %s", pod.Namespace, pod.Name, EventComponent))
+	}
+	if cli.option.Eviction.DeletionTimeout > 0 {
+		if err := cli.waitForPodsDeleted(ctx, node, evictions); err != nil {
+			return evictions, err
+		}
+	}
+	return evictions, nil
+}
+
+//
+func (cli *client) evictPod(ctx context.Context, eviction *policyV1beta1.Eviction, attempt int) (err error) {
+	ctx, span := tracing.Start(ctx, "EvictPod", tracing.AttributePod.String(eviction.Name), tracing.AttributeNamespace.String(eviction.Namespace), tracing.AttributeAttempt.Int(attempt))
+	defer func() { tracing.End(span, err) }()
+	return cli.kubernetesClient.PolicyV1beta1().Evictions(eviction.Namespace).Evict(ctx, eviction)
+}
+
+//
+func (cli *client) stopInstance(ctx context.Context, node *Node) (err error) {
+	ctx, span := tracing.Start(ctx, "StopInstance", tracing.AttributeNode.String(node.Name), tracing.AttributeZone.String(node.Zone))
+	defer func() { tracing.End(span, err) }()
+	err = cli.retry(ctx, "StopInstance", func(ctx context.Context) error {
+		_, err := cli.computeClient.Instances.Stop(cli.project, node.Zone, node.Name).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stop instance %s: %s", node.Name, err)
 	}
-	return evicted, nil
+	return nil
 }
 
 //
 func (cli *client) deleteNode(ctx context.Context, node *Node) error {
-	n, err := cli.kubernetesClient.CoreV1().Nodes().Get(ctx, node.Name, metaV1.GetOptions{})
+	var n *coreV1.Node
+	err := cli.retry(ctx, "GetNode", func(ctx context.Context) (err error) {
+		n, err = cli.kubernetesClient.CoreV1().Nodes().Get(ctx, node.Name, metaV1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("falid to get node %s: %s", node.Name, err)
 	}
 	if !n.Spec.Unschedulable {
 		return fmt.Errorf("detect schedulable flag, aborting deleteNode node %s: %s", node.Name, err)
 	}
-	if err := cli.kubernetesClient.CoreV1().Nodes().Delete(ctx, node.Name, metaV1.DeleteOptions{}); err != nil {
+	err = cli.retry(ctx, "DeleteNode", func(ctx context.Context) error {
+		return cli.kubernetesClient.CoreV1().Nodes().Delete(ctx, node.Name, metaV1.DeleteOptions{})
+	})
+	if err != nil {
 		return fmt.Errorf("detect schedulable flag, aborting deleteNode node %s: %s", node.Name, err)
 	}
-	if _, err := cli.computeClient.Instances.Stop(cli.project, node.Zone, node.Name).Context(ctx).Do(); err != nil {
-		return fmt.Errorf("failed to stop instance %s: %s", node.Name, err)
+	cli.recordEvent(ctx, nodeReference(n.Name, n.UID), coreV1.EventTypeNormal, EventReasonDelete, fmt.Sprintf("Node deleted by %s to refresh preemptible node", EventComponent))
+	if err := cli.stopInstance(ctx, node); err != nil {
+		return err
 	}
-	log.Infof("Succeeded in delete node: %s", node.Name)
+	cli.recordEvent(ctx, nodeReference(n.Name, n.UID), coreV1.EventTypeNormal, EventReasonStop, fmt.Sprintf("Instance %s stopped by %s", node.Name, EventComponent))
+	log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool}).Infof("Succeeded in delete node: %s", node.Name)
 	return nil
 }
@@ -0,0 +1,74 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//
+func BenchmarkGetNodeList(b *testing.B) {
+	for _, size := range []struct{ nodes, podsPerNode int }{{10, 30}, {150, 30}, {150, 100}} {
+		b.Run(fmt.Sprintf("nodes=%d,pods=%d", size.nodes, size.nodes*size.podsPerNode), func(b *testing.B) {
+			kubernetesClient := fake.NewSimpleClientset(newBenchmarkObjects(size.nodes, size.podsPerNode)...)
+			cli := &client{
+				clusterName:      "cluster",
+				kubernetesClient: kubernetesClient,
+				option:           ClientOption{Retry: RetryOption{MaxAttempts: 1}},
+			}
+			ctx := context.Background()
+			kubernetesClient.ClearActions()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				nodes, err := cli.GetNodeList(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(nodes) != size.nodes {
+					b.Fatalf("unexpected nodes length: expect=%d, actual=%d", size.nodes, len(nodes))
+				}
+			}
+			b.StopTimer()
+			calls := 0
+			for _, v := range kubernetesClient.Actions() {
+				if v.GetVerb() == "list" && v.GetResource().Resource == "pods" {
+					calls++
+				}
+			}
+			b.ReportMetric(float64(calls)/float64(b.N), "podlists/op")
+		})
+	}
+}
+
+//
+func newBenchmarkObjects(nodeCount, podsPerNode int) []runtime.Object {
+	objects := make([]runtime.Object, 0, nodeCount*(podsPerNode+1))
+	for i := 0; i < nodeCount; i++ {
+		nodeName := fmt.Sprintf("gke-cluster-pool-%08d", i)
+		objects = append(objects, &coreV1.Node{
+			ObjectMeta: metaV1.ObjectMeta{
+				Name: nodeName,
+				Labels: map[string]string{
+					NodePoolLabel:   "pool",
+					NodeRegionLabel: "asia-east1",
+					NodeZoneLabel:   "asia-east1-a",
+				},
+			},
+		})
+		for j := 0; j < podsPerNode; j++ {
+			objects = append(objects, &coreV1.Pod{
+				ObjectMeta: metaV1.ObjectMeta{
+					Name:      fmt.Sprintf("pod-%08d-%04d", i, j),
+					Namespace: "default",
+				},
+				Spec: coreV1.PodSpec{NodeName: nodeName},
+			})
+		}
+	}
+	return objects
+}
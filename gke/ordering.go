@@ -0,0 +1,172 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+
+	appsV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// RestartedAtAnnotation is the annotation of the pod template to restart the deployment, which is the same as kubectl rollout restart.
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// evictionOrder returns the pods in the order of the eviction, which is the lowest priority first.
+// The pods of the same priority keep the order of the node.
+func evictionOrder(pods []*Pod) []*Pod {
+	ret := make([]*Pod, len(pods))
+	copy(ret, pods)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Priority < ret[j].Priority
+	})
+	return ret
+}
+
+// workloadKey returns the key of the workload of the pod, which is unique in the cluster.
+func workloadKey(pod *Pod) string {
+	kind, name := pod.WorkloadName()
+	return pod.Namespace + "/" + kind + "/" + name
+}
+
+// waitForPodReplaced waits for the evicted pod of the stateful set to be recreated and ready up to the readiness timeout,
+// so that two pods of the same stateful set are not down at the same time.
+func (cli *client) waitForPodReplaced(ctx context.Context, node *Node, pod *Pod) error {
+	timeout := cli.option.Eviction.ReadinessTimeout
+	logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool, log.FieldPod: pod.Name, log.FieldNamespace: pod.Namespace})
+	deadline := time.Now().Add(timeout)
+	for {
+		ready, err := cli.isPodReplaced(ctx, pod)
+		if err != nil {
+			logger.Warnf("Failed to get pod %s: %s", pod.Name, err)
+		}
+		if ready {
+			logger.Infof("Succeeded in waiting for pod %s of %s/%s to be ready", pod.Name, pod.OwnerKind, pod.OwnerName)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for pod %s of %s/%s to be ready after %s", pod.Name, pod.OwnerKind, pod.OwnerName, timeout)
+		}
+		logger.Infof("Waiting for pod %s of %s/%s to be ready before the next eviction", pod.Name, pod.OwnerKind, pod.OwnerName)
+		if err := sleep(ctx, PodPollInterval); err != nil {
+			return fmt.Errorf("aborted waiting for pod %s to be ready: %s", pod.Name, err)
+		}
+	}
+}
+
+// isPodReplaced returns true if the pod which has the same name as the evicted pod is created and ready.
+func (cli *client) isPodReplaced(ctx context.Context, pod *Pod) (bool, error) {
+	var current *coreV1.Pod
+	err := cli.retry(ctx, "GetPod", func(ctx context.Context) (err error) {
+		current, err = cli.kubernetesClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metaV1.GetOptions{})
+		return err
+	})
+	if apiErrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(current.UID) != pod.UID && current.DeletionTimestamp == nil && isPodReady(current.Status), nil
+}
+
+// restartDeployment restarts the deployment of the pod instead of the eviction if it has only one replica,
+// so that the new pod is surged on another node before the pod is deleted. It returns false if the deployment cannot surge.
+func (cli *client) restartDeployment(ctx context.Context, node *Node, pod *Pod) (bool, error) {
+	var deployment *appsV1.Deployment
+	err := cli.retry(ctx, "GetDeployment", func(ctx context.Context) (err error) {
+		deployment, err = cli.kubernetesClient.AppsV1().Deployments(pod.Namespace).Get(ctx, pod.OwnerName, metaV1.GetOptions{})
+		return err
+	})
+	if apiErrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get deployment %s: %s", pod.OwnerName, err)
+	}
+	if !canSurge(deployment) || !isPodReady(pod.Status) {
+		return false, nil // evict as the others
+	}
+	logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool, log.FieldPod: pod.Name, log.FieldNamespace: pod.Namespace})
+	logger.Infof("Restart single replica deployment %s instead of eviction of pod %s", deployment.Name, pod.Name)
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, RestartedAtAnnotation, time.Now().Format(time.RFC3339))
+	err = cli.retry(ctx, "PatchDeployment", func(ctx context.Context) (err error) {
+		deployment, err = cli.kubernetesClient.AppsV1().Deployments(pod.Namespace).Patch(ctx, deployment.Name, types.StrategicMergePatchType, []byte(patch), metaV1.PatchOptions{})
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to restart deployment %s: %s", pod.OwnerName, err)
+	}
+	if err := cli.waitForRollout(ctx, node, deployment.Name, pod.Namespace, deployment.Generation); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// waitForRollout waits for the restarted deployment to replace the old pod by the new ready pod up to the readiness timeout.
+func (cli *client) waitForRollout(ctx context.Context, node *Node, name, namespace string, generation int64) error {
+	timeout := cli.option.Eviction.ReadinessTimeout
+	logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool, log.FieldNamespace: namespace})
+	deadline := time.Now().Add(timeout)
+	for {
+		var deployment *appsV1.Deployment
+		err := cli.retry(ctx, "GetDeployment", func(ctx context.Context) (err error) {
+			deployment, err = cli.kubernetesClient.AppsV1().Deployments(namespace).Get(ctx, name, metaV1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			logger.Warnf("Failed to get deployment %s: %s", name, err)
+		} else if isRolledOut(deployment, generation) {
+			logger.Infof("Succeeded in rollout of deployment %s", name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for rollout of deployment %s after %s", name, timeout)
+		}
+		logger.Infof("Waiting for rollout of deployment %s", name)
+		if err := sleep(ctx, PodPollInterval); err != nil {
+			return fmt.Errorf("aborted waiting for rollout of deployment %s: %s", name, err)
+		}
+	}
+}
+
+// canSurge returns true if the deployment has only one replica, and its rolling update creates the new pod before deleting the old pod.
+func canSurge(deployment *appsV1.Deployment) bool {
+	spec := deployment.Spec
+	if spec.Replicas == nil || *spec.Replicas != 1 || spec.Paused || spec.Strategy.Type != appsV1.RollingUpdateDeploymentStrategyType {
+		return false
+	}
+	maxSurge := intstr.FromString("25%") // default of the deployment
+	if spec.Strategy.RollingUpdate != nil && spec.Strategy.RollingUpdate.MaxSurge != nil {
+		maxSurge = *spec.Strategy.RollingUpdate.MaxSurge
+	}
+	surge, err := intstr.GetScaledValueFromIntOrPercent(&maxSurge, 1, true)
+	return err == nil && surge > 0
+}
+
+// isRolledOut returns true if all replicas of the deployment are updated and available, and the old replicas are gone.
+func isRolledOut(deployment *appsV1.Deployment, generation int64) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= generation && status.UpdatedReplicas >= replicas && status.AvailableReplicas >= replicas && status.Replicas <= status.UpdatedReplicas
+}
+
+//
+func isPodReady(status coreV1.PodStatus) bool {
+	for _, v := range status.Conditions {
+		if v.Type == coreV1.PodReady {
+			return v.Status == coreV1.ConditionTrue
+		}
+	}
+	return false
+}
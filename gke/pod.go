@@ -0,0 +1,106 @@
+package gke
+
+import (
+	"fmt"
+	"strings"
+
+	coreV1 "k8s.io/api/core/v1"
+)
+
+//
+const (
+	VolumeKindEmptyDir              = "emptyDir"
+	VolumeKindPersistentVolumeClaim = "persistentVolumeClaim"
+)
+
+// SafeToEvictAnnotation is the annotation of the cluster autoscaler whether the pod can be evicted to scale down the node.
+const SafeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+// AnnotationPrefix is the prefix of the annotations of the optimizer.
+const AnnotationPrefix = "gke-node-optimizer/"
+
+// Volume is the volume of the pod which is lost or detached by the eviction.
+type Volume struct {
+	Name string
+	Kind string
+	// ClaimName is the name of the persistent volume claim.
+	ClaimName string
+}
+
+// WorkloadName returns the kind and the name of the controller of the pod, or the pod itself if not controlled.
+func (p *Pod) WorkloadName() (kind, name string) {
+	if p.OwnerKind == "" {
+		return "Pod", p.Name
+	}
+	return p.OwnerKind, p.OwnerName
+}
+
+// Workload is the pods of the same controller.
+type Workload struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Pods      []*Pod
+}
+
+//
+func (w *Workload) String() string {
+	return fmt.Sprintf("%s/%s", w.Kind, w.Name)
+}
+
+// GroupByWorkload groups the pods by the controller in the order of the first appearance.
+func GroupByWorkload(pods []*Pod) []*Workload {
+	ret := make([]*Workload, 0, len(pods))
+	index := make(map[string]*Workload, len(pods))
+	for _, v := range pods {
+		kind, name := v.WorkloadName()
+		key := v.Namespace + "/" + kind + "/" + name
+		w, ok := index[key]
+		if !ok {
+			w = &Workload{Kind: kind, Name: name, Namespace: v.Namespace}
+			index[key] = w
+			ret = append(ret, w)
+		}
+		w.Pods = append(w.Pods, v)
+	}
+	return ret
+}
+
+// podOwner returns the controller of the pod. The ReplicaSet is resolved to the Deployment by the pod template hash.
+func podOwner(in coreV1.Pod) (kind, name string) {
+	for _, v := range in.OwnerReferences {
+		if v.Controller == nil || !*v.Controller {
+			continue
+		}
+		if hash := in.Labels["pod-template-hash"]; v.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(v.Name, "-"+hash) {
+			return "Deployment", strings.TrimSuffix(v.Name, "-"+hash)
+		}
+		return v.Kind, v.Name
+	}
+	return "", ""
+}
+
+// podVolumes returns the emptyDir and the persistent volume claim volumes of the pod.
+func podVolumes(spec coreV1.PodSpec) []Volume {
+	ret := make([]Volume, 0, len(spec.Volumes))
+	for _, v := range spec.Volumes {
+		switch {
+		case v.EmptyDir != nil:
+			ret = append(ret, Volume{Name: v.Name, Kind: VolumeKindEmptyDir})
+		case v.PersistentVolumeClaim != nil:
+			ret = append(ret, Volume{Name: v.Name, Kind: VolumeKindPersistentVolumeClaim, ClaimName: v.PersistentVolumeClaim.ClaimName})
+		}
+	}
+	return ret
+}
+
+// podAnnotations returns the annotations relevant to the drain.
+func podAnnotations(in map[string]string) map[string]string {
+	ret := make(map[string]string)
+	for k, v := range in {
+		if k == SafeToEvictAnnotation || strings.HasPrefix(k, AnnotationPrefix) {
+			ret[k] = v
+		}
+	}
+	return ret
+}
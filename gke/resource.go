@@ -0,0 +1,96 @@
+package gke
+
+import (
+	coreV1 "k8s.io/api/core/v1"
+)
+
+// Resources is the amount of the resources considered by the scheduler.
+type Resources struct {
+	MilliCPU int64
+	Memory   int64 // bytes
+	Pods     int64
+}
+
+//
+func newResources(in coreV1.ResourceList) Resources {
+	return Resources{
+		MilliCPU: in.Cpu().MilliValue(),
+		Memory:   in.Memory().Value(),
+		Pods:     in.Pods().Value(),
+	}
+}
+
+// Add returns the sum of the resources.
+func (r Resources) Add(other Resources) Resources {
+	return Resources{
+		MilliCPU: r.MilliCPU + other.MilliCPU,
+		Memory:   r.Memory + other.Memory,
+		Pods:     r.Pods + other.Pods,
+	}
+}
+
+// Sub returns the difference of the resources.
+func (r Resources) Sub(other Resources) Resources {
+	return Resources{
+		MilliCPU: r.MilliCPU - other.MilliCPU,
+		Memory:   r.Memory - other.Memory,
+		Pods:     r.Pods - other.Pods,
+	}
+}
+
+// Fits returns true if the resources are within the capacity.
+func (r Resources) Fits(capacity Resources) bool {
+	return r.MilliCPU <= capacity.MilliCPU && r.Memory <= capacity.Memory && r.Pods <= capacity.Pods
+}
+
+// IsTerminated returns true if the pod has finished, which no longer occupies the resources.
+func (p *Pod) IsTerminated() bool {
+	return p.Status.Phase == coreV1.PodSucceeded || p.Status.Phase == coreV1.PodFailed
+}
+
+// IsMovable returns true if the pod is rescheduled to another node by the eviction.
+// The pods of the DaemonSet and the static pods stay on the node.
+func (p *Pod) IsMovable() bool {
+	return p.OwnerKind != "DaemonSet" && p.OwnerKind != "Node" && !p.IsTerminated()
+}
+
+// RequestedResources returns the resources requested by the running pods on the node.
+func (n *Node) RequestedResources() Resources {
+	var ret Resources
+	for _, v := range n.Pods {
+		if !v.IsTerminated() {
+			ret = ret.Add(v.Requests)
+		}
+	}
+	return ret
+}
+
+// podRequests returns the effective requests of the pod in the same way as the scheduler,
+// which is the larger of the sum of the containers and the largest init container, plus the overhead.
+func podRequests(spec coreV1.PodSpec) Resources {
+	var ret Resources
+	for _, v := range spec.Containers {
+		ret = ret.Add(newResources(v.Resources.Requests))
+	}
+	for _, v := range spec.InitContainers {
+		init := newResources(v.Resources.Requests)
+		if init.MilliCPU > ret.MilliCPU {
+			ret.MilliCPU = init.MilliCPU
+		}
+		if init.Memory > ret.Memory {
+			ret.Memory = init.Memory
+		}
+	}
+	ret = ret.Add(newResources(spec.Overhead))
+	ret.Pods = 1
+	return ret
+}
+
+// podLimits returns the sum of the limits of the containers, where the container without the limit is not counted.
+func podLimits(spec coreV1.PodSpec) Resources {
+	var ret Resources
+	for _, v := range spec.Containers {
+		ret = ret.Add(newResources(v.Resources.Limits))
+	}
+	return ret
+}
@@ -0,0 +1,105 @@
+package gke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+//
+type RetryOption struct {
+	// MaxAttempts is the maximum number of attempts including the first call. No retry if less than 2.
+	MaxAttempts int
+	// InitialInterval is the base interval before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval is the upper limit of the interval between retries.
+	MaxInterval time.Duration
+}
+
+// retry calls the function until it succeeds, returns a non-retryable error, or runs out of attempts or deadline.
+func (cli *client) retry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	option := cli.option.Retry
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= option.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+		interval := backoff(option, attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < interval {
+			return fmt.Errorf("give up retry because context deadline will be exceeded: %w", err)
+		}
+		log.Warnf("Retry %s after %s. attempt=%d: %s", operation, interval, attempt, err)
+		if err := sleep(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the exponential interval with the jitter, which is between half and full of the interval.
+func backoff(option RetryOption, attempt int) time.Duration {
+	interval := option.InitialInterval
+	for i := 1; i < attempt && interval < option.MaxInterval; i++ {
+		interval *= 2
+	}
+	if option.MaxInterval > 0 && interval > option.MaxInterval {
+		interval = option.MaxInterval
+	}
+	if interval <= 0 {
+		return 0
+	}
+	half := interval / 2
+	return half + time.Duration(rand.Int63n(int64(interval-half)+1))
+}
+
+// sleep waits for the duration, or returns the error if the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryable returns true if the error of the GKE, Compute or Kubernetes API is transient.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if s, ok := status.FromError(err); ok && s.Code() != codes.OK && s.Code() != codes.Unknown {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded, codes.Internal:
+			return true
+		}
+		return false
+	}
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		switch gErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return apiErrors.IsConflict(err) ||
+		apiErrors.IsTooManyRequests(err) ||
+		apiErrors.IsServerTimeout(err) ||
+		apiErrors.IsTimeout(err) ||
+		apiErrors.IsServiceUnavailable(err) ||
+		apiErrors.IsInternalError(err)
+}
@@ -0,0 +1,93 @@
+package gke
+
+import (
+	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// CanScheduleOn returns true if the pod tolerates the taints of the node, and selects the labels of the node.
+// Only the NoSchedule and NoExecute taints, the node selector and the required node affinity are checked like the scheduler.
+func (p *Pod) CanScheduleOn(node *Node) bool {
+	for i := range node.Taints {
+		taint := &node.Taints[i]
+		if taint.Effect == coreV1.TaintEffectPreferNoSchedule || tolerates(p.Tolerations, taint) {
+			continue
+		}
+		return false
+	}
+	if !labels.SelectorFromSet(p.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if p.RequiredNodeAffinity == nil {
+		return true
+	}
+	for _, term := range p.RequiredNodeAffinity.NodeSelectorTerms {
+		if matchNodeSelectorTerm(term, node) {
+			return true // terms are ORed
+		}
+	}
+	return false
+}
+
+//
+func tolerates(tolerations []coreV1.Toleration, taint *coreV1.Taint) bool {
+	for _, v := range tolerations {
+		if v.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchNodeSelectorTerm returns true if the node matches all requirements of the term. The empty term matches nothing.
+func matchNodeSelectorTerm(term coreV1.NodeSelectorTerm, node *Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, v := range term.MatchExpressions {
+		if !matchNodeSelectorRequirement(v, node.Labels) {
+			return false
+		}
+	}
+	for _, v := range term.MatchFields {
+		if v.Key != "metadata.name" || !matchNodeSelectorRequirement(v, labels.Set{v.Key: node.Name}) {
+			return false
+		}
+	}
+	return true
+}
+
+//
+func matchNodeSelectorRequirement(in coreV1.NodeSelectorRequirement, set labels.Set) bool {
+	var op selection.Operator
+	switch in.Operator {
+	case coreV1.NodeSelectorOpIn:
+		op = selection.In
+	case coreV1.NodeSelectorOpNotIn:
+		op = selection.NotIn
+	case coreV1.NodeSelectorOpExists:
+		op = selection.Exists
+	case coreV1.NodeSelectorOpDoesNotExist:
+		op = selection.DoesNotExist
+	case coreV1.NodeSelectorOpGt:
+		op = selection.GreaterThan
+	case coreV1.NodeSelectorOpLt:
+		op = selection.LessThan
+	default:
+		return false
+	}
+	r, err := labels.NewRequirement(in.Key, op, in.Values)
+	if err != nil {
+		return false
+	}
+	return r.Matches(set)
+}
+
+//
+func requiredNodeAffinity(in *coreV1.Affinity) *coreV1.NodeSelector {
+	if in == nil || in.NodeAffinity == nil {
+		return nil
+	}
+	return in.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+}
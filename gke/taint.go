@@ -0,0 +1,119 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+	"github.com/na-ga/gke-node-optimizer/tracing"
+
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PreDrainTaintAnnotation is the annotation which keeps the pre-drain taint added by the optimizer, to remove it later.
+const PreDrainTaintAnnotation = "gke-node-optimizer/pre-drain-taint"
+
+// ParseTaint parses the taint in the form of `key[=value]:effect`, whose effect is NoSchedule or PreferNoSchedule.
+func ParseTaint(s string) (*coreV1.Taint, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid taint %s: effect is required", s)
+	}
+	taint := &coreV1.Taint{Key: s[:i], Effect: coreV1.TaintEffect(s[i+1:])}
+	if j := strings.Index(taint.Key, "="); j >= 0 {
+		taint.Key, taint.Value = taint.Key[:j], taint.Key[j+1:]
+	}
+	if taint.Key == "" {
+		return nil, fmt.Errorf("invalid taint %s: key is required", s)
+	}
+	switch taint.Effect {
+	case coreV1.TaintEffectNoSchedule, coreV1.TaintEffectPreferNoSchedule:
+	default:
+		return nil, fmt.Errorf("invalid taint %s: effect must be NoSchedule or PreferNoSchedule", s)
+	}
+	return taint, nil
+}
+
+// preDrain taints the nodes to signal the coming drain, and waits for the pre-drain period.
+// The taints are removed with the uncordon on the rollback.
+func (cli *client) preDrain(ctx context.Context, nodes []*Node) error {
+	taint := cli.option.PreDrainTaint
+	if taint == nil {
+		return nil
+	}
+	for _, node := range nodes {
+		if err := cli.taintNode(ctx, node.Name, taint); err != nil {
+			return fmt.Errorf("failed to taint node %s: %s", node.Name, err)
+		}
+	}
+	if cli.option.PreDrainPeriod <= 0 {
+		return nil
+	}
+	log.Infof("Waiting %s after taint %s before drain", cli.option.PreDrainPeriod, taint.ToString())
+	if err := sleep(ctx, cli.option.PreDrainPeriod); err != nil {
+		return fmt.Errorf("aborted pre-drain period: %s", err)
+	}
+	return nil
+}
+
+//
+func (cli *client) taintNode(ctx context.Context, nodeName string, taint *coreV1.Taint) (err error) {
+	ctx, span := tracing.Start(ctx, "TaintNode", tracing.AttributeNode.String(nodeName))
+	defer func() { tracing.End(span, err) }()
+	var n *coreV1.Node
+	updated := false
+	err = cli.retry(ctx, "TaintNode", func(ctx context.Context) (err error) {
+		n, err = cli.kubernetesClient.CoreV1().Nodes().Get(ctx, nodeName, metaV1.GetOptions{}) // re-read on conflict
+		if err != nil {
+			return err
+		}
+		for _, v := range n.Spec.Taints {
+			if v.MatchTaint(taint) {
+				return nil
+			}
+		}
+		n.Spec.Taints = append(n.Spec.Taints, *taint)
+		if n.Annotations == nil {
+			n.Annotations = make(map[string]string, 1)
+		}
+		n.Annotations[PreDrainTaintAnnotation] = taint.ToString() // mark to remove by the optimizer later
+		if _, err = cli.kubernetesClient.CoreV1().Nodes().Update(ctx, n, metaV1.UpdateOptions{}); err != nil {
+			return err
+		}
+		updated = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !updated {
+		log.WithFields(log.Fields{log.FieldNode: nodeName}).Infof("Already tainted %s: %s", taint.ToString(), nodeName)
+		return nil
+	}
+	log.WithFields(log.Fields{log.FieldNode: nodeName}).Infof("Succeeded in taint node %s: %s", taint.ToString(), nodeName)
+	cli.recordEvent(ctx, nodeReference(n.Name, n.UID), coreV1.EventTypeNormal, EventReasonTaint, fmt.Sprintf("Node tainted %s by %s before drain", taint.ToString(), EventComponent))
+	return nil
+}
+
+// removePreDrainTaint removes the taint recorded in the annotation from the node.
+func removePreDrainTaint(n *coreV1.Node) {
+	value, ok := n.Annotations[PreDrainTaintAnnotation]
+	if !ok {
+		return
+	}
+	delete(n.Annotations, PreDrainTaintAnnotation)
+	taint, err := ParseTaint(value)
+	if err != nil {
+		log.WithFields(log.Fields{log.FieldNode: n.Name}).Warnf("Ignore invalid pre-drain taint annotation of node %s: %s", n.Name, err)
+		return
+	}
+	taints := make([]coreV1.Taint, 0, len(n.Spec.Taints))
+	for _, v := range n.Spec.Taints {
+		if !v.MatchTaint(taint) {
+			taints = append(taints, v)
+		}
+	}
+	n.Spec.Taints = taints
+}
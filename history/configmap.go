@@ -0,0 +1,87 @@
+package history
+
+import (
+	"context"
+	"fmt"
+
+	coreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	ConfigMapKey = "history.jsonl"
+)
+
+//
+type configMapStore struct {
+	kubernetesClient kubernetes.Interface
+	namespace        string
+	name             string
+	maxRecords       int
+}
+
+// NewConfigMapStore returns the store which keeps the records in the config map as JSON lines.
+// Note that the size of a config map is limited to 1MiB, so that the maximum number of records should be limited.
+func NewConfigMapStore(kubernetesClient kubernetes.Interface, namespace, name string, maxRecords int) Store {
+	return &configMapStore{
+		kubernetesClient: kubernetesClient,
+		namespace:        namespace,
+		name:             name,
+		maxRecords:       maxRecords,
+	}
+}
+
+//
+func (s *configMapStore) Append(ctx context.Context, record *Record) error {
+	configMaps := s.kubernetesClient.CoreV1().ConfigMaps(s.namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, s.name, metaV1.GetOptions{})
+		if apiErrors.IsNotFound(err) {
+			b, err := encode([]*Record{record})
+			if err != nil {
+				return err
+			}
+			configMap = &coreV1.ConfigMap{
+				ObjectMeta: metaV1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string]string{ConfigMapKey: string(b)},
+			}
+			_, err = configMaps.Create(ctx, configMap, metaV1.CreateOptions{})
+			if apiErrors.IsAlreadyExists(err) {
+				return apiErrors.NewConflict(coreV1.Resource("configmaps"), s.name, err) // retry by update
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		b, err := encode(appendRecord(decode([]byte(configMap.Data[ConfigMapKey])), record, s.maxRecords))
+		if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string, 1)
+		}
+		configMap.Data[ConfigMapKey] = string(b)
+		_, err = configMaps.Update(ctx, configMap, metaV1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append history to config map %s/%s: %s", s.namespace, s.name, err)
+	}
+	return nil
+}
+
+//
+func (s *configMapStore) List(ctx context.Context) ([]*Record, error) {
+	configMap, err := s.kubernetesClient.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		return []*Record{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history config map %s/%s: %s", s.namespace, s.name, err)
+	}
+	return decode([]byte(configMap.Data[ConfigMapKey])), nil
+}
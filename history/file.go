@@ -0,0 +1,62 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//
+type fileStore struct {
+	path       string
+	maxRecords int
+}
+
+// NewFileStore returns the store which keeps the records in the local file as JSON lines.
+func NewFileStore(path string, maxRecords int) Store {
+	return &fileStore{
+		path:       path,
+		maxRecords: maxRecords,
+	}
+}
+
+//
+func (s *fileStore) Append(ctx context.Context, record *Record) error {
+	records, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := encode(appendRecord(records, record, s.maxRecords))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary history file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write history file %s: %s", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close history file %s: %s", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace history file %s: %s", s.path, err)
+	}
+	return nil
+}
+
+//
+func (s *fileStore) List(ctx context.Context) ([]*Record, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return []*Record{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file %s: %s", s.path, err)
+	}
+	return decode(b), nil
+}
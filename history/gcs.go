@@ -0,0 +1,114 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storageV1 "google.golang.org/api/storage/v1"
+)
+
+const (
+	gcsMaxAttempts = 5
+)
+
+//
+type gcsStore struct {
+	service    *storageV1.Service
+	bucket     string
+	object     string
+	maxRecords int
+}
+
+// NewGCSStore returns the store which keeps the records in the object of the GCS or GCS compatible storage as JSON lines.
+// The endpoint is used instead of the GCS if not empty.
+func NewGCSStore(ctx context.Context, endpoint, bucket, object string, maxRecords int) (Store, error) {
+	opts := make([]option.ClientOption, 0, 2)
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	service, err := storageV1.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %s", err)
+	}
+	return &gcsStore{
+		service:    service,
+		bucket:     bucket,
+		object:     object,
+		maxRecords: maxRecords,
+	}, nil
+}
+
+// Append updates the object with the generation precondition, and retries if the object is updated by others.
+func (s *gcsStore) Append(ctx context.Context, record *Record) error {
+	for attempt := 1; ; attempt++ {
+		records, generation, err := s.read(ctx)
+		if err != nil {
+			return err
+		}
+		b, err := encode(appendRecord(records, record, s.maxRecords))
+		if err != nil {
+			return err
+		}
+		_, err = s.service.Objects.Insert(s.bucket, &storageV1.Object{Name: s.object, ContentType: "application/x-ndjson"}).
+			IfGenerationMatch(generation).
+			Media(bytes.NewReader(b)).
+			Context(ctx).
+			Do()
+		var gErr *googleapi.Error
+		if err != nil && errors.As(err, &gErr) && gErr.Code == http.StatusPreconditionFailed && attempt < gcsMaxAttempts {
+			continue // updated by others
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write history object gs://%s/%s: %s", s.bucket, s.object, err)
+		}
+		return nil
+	}
+}
+
+//
+func (s *gcsStore) List(ctx context.Context) ([]*Record, error) {
+	records, _, err := s.read(ctx)
+	return records, err
+}
+
+// read returns the records and the generation of the object, which is 0 if the object does not exist.
+// The generation is read from the metadata, and the content of the generation is downloaded.
+func (s *gcsStore) read(ctx context.Context) ([]*Record, int64, error) {
+	for attempt := 1; ; attempt++ {
+		obj, err := s.service.Objects.Get(s.bucket, s.object).Context(ctx).Do()
+		if isGCSNotFound(err) {
+			return []*Record{}, 0, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get history object gs://%s/%s: %s", s.bucket, s.object, err)
+		}
+		if obj.Generation <= 0 {
+			return nil, 0, fmt.Errorf("failed to get generation of history object gs://%s/%s", s.bucket, s.object)
+		}
+		res, err := s.service.Objects.Get(s.bucket, s.object).Generation(obj.Generation).Context(ctx).Download()
+		if isGCSNotFound(err) && attempt < gcsMaxAttempts {
+			continue // updated by others after getting the generation
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read history object gs://%s/%s: %s", s.bucket, s.object, err)
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read history object gs://%s/%s: %s", s.bucket, s.object, err)
+		}
+		return decode(b), obj.Generation, nil
+	}
+}
+
+//
+func isGCSNotFound(err error) bool {
+	var gErr *googleapi.Error
+	return err != nil && errors.As(err, &gErr) && gErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,175 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/report"
+)
+
+// Record is the compact form of the result of a run.
+type Record struct {
+	RunID                    string    `json:"run_id"`
+	StartTime                time.Time `json:"start_time"`
+	EndTime                  time.Time `json:"end_time"`
+	Severity                 string    `json:"severity"`
+	Succeeded                bool      `json:"succeeded"`
+	Aborted                  bool      `json:"aborted,omitempty"`
+	Error                    string    `json:"error,omitempty"`
+	DeferredReason           string    `json:"deferred_reason,omitempty"`
+	NodeCount                int       `json:"node_count"`
+	PreemptibleNodeCount     int       `json:"preemptible_node_count"`
+	OndemandNodeCount        int       `json:"ondemand_node_count"`
+	RefreshedNode            string    `json:"refreshed_node,omitempty"`
+	RefreshedNodeAgeSeconds  int64     `json:"refreshed_node_age_seconds,omitempty"`
+	DrainedOndemandNode      string    `json:"drained_ondemand_node,omitempty"` // comma separated if consolidated
+	EvictedPodCount          int       `json:"evicted_pod_count"`
+	EstimatedSavings         float64   `json:"estimated_savings,omitempty"`
+	EstimatedSavingsCurrency string    `json:"estimated_savings_currency,omitempty"`
+}
+
+// Store keeps the records of the runs.
+type Store interface {
+	// Append appends the record, and drops the oldest records over the maximum number.
+	Append(ctx context.Context, record *Record) error
+	// List returns the records in the order of appending.
+	List(ctx context.Context) ([]*Record, error)
+}
+
+// NewRecord returns the record of the result.
+func NewRecord(result *report.Result) *Record {
+	ret := &Record{
+		RunID:                result.RunID(),
+		StartTime:            result.StartTime(),
+		EndTime:              result.EndTime(),
+		Severity:             result.Severity().String(),
+		Succeeded:            result.Error == nil,
+		Aborted:              result.Aborted,
+		DeferredReason:       result.DeferredReason,
+		NodeCount:            len(result.ActiveNodes),
+		PreemptibleNodeCount: result.PreemptibleNodeActualCount,
+		EvictedPodCount:      len(result.EvictedPods),
+	}
+	if result.Error != nil {
+		ret.Error = result.Error.Error()
+	}
+	for _, v := range result.ActiveNodes {
+		if !v.Preemptible {
+			ret.OndemandNodeCount++
+		}
+	}
+	if v := result.TargetPreemptibleNode; v != nil {
+		ret.RefreshedNode = v.Name
+		ret.RefreshedNodeAgeSeconds = int64(v.Age / time.Second)
+	}
+	drained := make([]string, 0, 1)
+	for _, v := range result.GetTargetOndemandAutoscaleNodes() {
+		drained = append(drained, v.Name)
+	}
+	ret.DrainedOndemandNode = strings.Join(drained, ",")
+	if v := result.CostEstimate; v != nil {
+		ret.EstimatedSavings = v.Savings
+		ret.EstimatedSavingsCurrency = v.Currency
+	}
+	return ret
+}
+
+// NewTrend returns the trend of the records.
+// The failures which have the same message before the first colon are regarded as the same failure.
+func NewTrend(records []*Record) *report.Trend {
+	ret := &report.Trend{
+		Runs:               len(records),
+		OndemandNodeCounts: make([]report.TrendPoint, 0, len(records)),
+	}
+	var ageSum time.Duration
+	ageCount := 0
+	failures := make(map[string]*report.RecurringFailure)
+	for _, v := range records {
+		if ret.Since.IsZero() || v.StartTime.Before(ret.Since) {
+			ret.Since = v.StartTime
+		}
+		if v.Succeeded {
+			ret.SucceededRuns++
+		} else {
+			message := v.Error
+			if i := strings.Index(message, ":"); i > 0 {
+				message = message[:i]
+			}
+			if _, ok := failures[message]; !ok {
+				failures[message] = &report.RecurringFailure{Message: message}
+			}
+			failures[message].Count++
+			if v.StartTime.After(failures[message].LastTime) {
+				failures[message].LastTime = v.StartTime
+			}
+		}
+		if v.RefreshedNode != "" {
+			ageSum += time.Duration(v.RefreshedNodeAgeSeconds) * time.Second
+			ageCount++
+		}
+		if v.NodeCount > 0 {
+			ret.OndemandNodeCounts = append(ret.OndemandNodeCounts, report.TrendPoint{Time: v.StartTime, Count: v.OndemandNodeCount})
+		}
+	}
+	if ageCount > 0 {
+		ret.AverageRefreshedNodeAge = ageSum / time.Duration(ageCount)
+	}
+	for _, v := range failures {
+		if v.Count > 1 {
+			ret.RecurringFailures = append(ret.RecurringFailures, *v)
+		}
+	}
+	sort.Slice(ret.RecurringFailures, func(i, j int) bool {
+		if ret.RecurringFailures[i].Count != ret.RecurringFailures[j].Count {
+			return ret.RecurringFailures[i].Count > ret.RecurringFailures[j].Count
+		}
+		return ret.RecurringFailures[i].Message < ret.RecurringFailures[j].Message
+	})
+	return ret
+}
+
+// encode returns the records in JSON lines.
+func encode(records []*Record) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, v := range records {
+		if err := enc.Encode(v); err != nil {
+			return nil, fmt.Errorf("failed to encode record %s: %s", v.RunID, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decode returns the records from JSON lines. The broken lines are skipped.
+func decode(b []byte) []*Record {
+	ret := make([]*Record, 0, bytes.Count(b, []byte("\n")))
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			continue
+		}
+		ret = append(ret, &record)
+	}
+	return ret
+}
+
+// appendRecord appends the record and drops the oldest records over the maximum number, or no limit if less than 1.
+func appendRecord(records []*Record, record *Record, maxRecords int) []*Record {
+	records = append(records, record)
+	if maxRecords > 0 && len(records) > maxRecords {
+		records = records[len(records)-maxRecords:]
+	}
+	return records
+}
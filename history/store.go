@@ -0,0 +1,48 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+//
+type StoreOption struct {
+	// MaxRecords is the maximum number of records to keep, or no limit if less than 1.
+	MaxRecords int
+	// UseLocalKubeConfig is true if the config map store uses the local kube config.
+	UseLocalKubeConfig bool
+	// StorageEndpoint is the endpoint of the GCS compatible storage, or empty to use the GCS.
+	StorageEndpoint string
+}
+
+// NewStore returns the store by the location, which is one of `file:PATH`, `configmap:NAMESPACE/NAME` or `gs://BUCKET/OBJECT`.
+func NewStore(ctx context.Context, location string, option StoreOption) (Store, error) {
+	switch {
+	case strings.HasPrefix(location, "file:"):
+		path := strings.TrimPrefix(location, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("history file path is empty: %s", location)
+		}
+		return NewFileStore(path, option.MaxRecords), nil
+	case strings.HasPrefix(location, "configmap:"):
+		namespace, name, ok := strings.Cut(strings.TrimPrefix(location, "configmap:"), "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, fmt.Errorf("history config map must be NAMESPACE/NAME: %s", location)
+		}
+		kubernetesClient, err := gke.NewKubernetesClient(option.UseLocalKubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		return NewConfigMapStore(kubernetesClient, namespace, name, option.MaxRecords), nil
+	case strings.HasPrefix(location, "gs://"):
+		bucket, object, ok := strings.Cut(strings.TrimPrefix(location, "gs://"), "/")
+		if !ok || bucket == "" || object == "" {
+			return nil, fmt.Errorf("history object must be gs://BUCKET/OBJECT: %s", location)
+		}
+		return NewGCSStore(ctx, option.StorageEndpoint, bucket, object, option.MaxRecords)
+	}
+	return nil, fmt.Errorf("unsupported history store: %s", location)
+}
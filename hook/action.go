@@ -0,0 +1,65 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// call posts the payload, and returns the response body.
+func (a *HTTPAction) call(ctx context.Context, payload *Payload) (string, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %s", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(b))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range a.Headers {
+		req.Header.Set(k, os.ExpandEnv(v)) // allow secrets by env vars
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to post %s: %s", a.URL, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, OutputMaxLength))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response of %s: %s", a.URL, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return string(body), fmt.Errorf("unexpected status of %s: %s", a.URL, res.Status)
+	}
+	return string(body), nil
+}
+
+// call runs the command with the payload as the standard input, and returns the combined output.
+func (a *ExecAction) call(ctx context.Context, payload *Payload) (string, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %s", err)
+	}
+	cmd := exec.CommandContext(ctx, a.Command[0], a.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Env = append(os.Environ(),
+		"HOOK_RUN_ID="+payload.RunID,
+		"HOOK_PHASE="+string(payload.Phase),
+		"HOOK_NODE_NAME="+payload.Node.Name,
+		"HOOK_NODE_POOL="+payload.Node.NodePool,
+	)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return string(output), fmt.Errorf("timed out command %s: %s", a.Command[0], ctx.Err())
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("failed to run command %s: %s", a.Command[0], err)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,301 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+	"github.com/na-ga/gke-node-optimizer/log"
+
+	"sigs.k8s.io/yaml"
+)
+
+//
+const (
+	PhasePreDrain  Phase = "pre-drain"
+	PhasePostDrain Phase = "post-drain"
+	ModeVeto       Mode  = "veto"
+	ModeAdvise     Mode  = "advise"
+)
+
+// DefaultTimeout is the timeout of a hook if not specified.
+const DefaultTimeout = 30 * time.Second
+
+// OutputMaxLength is the maximum length of the output of a hook kept in the result.
+const OutputMaxLength = 1024
+
+// Phase is when the hook is called.
+type Phase string
+
+// Mode is whether the failure of the hook cancels the drain. The post-drain hooks are always advisory.
+type Mode string
+
+// Hook is the HTTP call or the local command called around the drain.
+type Hook struct {
+	Name    string      `json:"name"`
+	Phase   Phase       `json:"phase"`
+	Mode    Mode        `json:"mode"`
+	Timeout string      `json:"timeout"`
+	HTTP    *HTTPAction `json:"http"`
+	Exec    *ExecAction `json:"exec"`
+	timeout time.Duration
+}
+
+// HTTPAction posts the payload in JSON to the URL, and succeeds by the status code 2xx.
+type HTTPAction struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// ExecAction runs the command with the payload in JSON as the standard input, and succeeds by the exit code 0.
+type ExecAction struct {
+	Command []string `json:"command"`
+}
+
+// Result is the result of a hook call.
+type Result struct {
+	Name     string
+	Phase    Phase
+	Mode     Mode
+	NodeName string
+	Duration time.Duration
+	Output   string
+	Err      error
+}
+
+// Vetoed returns true if the hook canceled the drain.
+func (r *Result) Vetoed() bool {
+	return r.Err != nil && r.Phase == PhasePreDrain && r.Mode == ModeVeto
+}
+
+// Payload is the information of the drain passed to the hooks.
+type Payload struct {
+	RunID       string            `json:"run_id"`
+	Phase       Phase             `json:"phase"`
+	ClusterName string            `json:"cluster_name"`
+	Node        PayloadNode       `json:"node"`
+	Pods        []PayloadPod      `json:"pods"`
+	Evictions   []PayloadEviction `json:"evictions,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+//
+type PayloadNode struct {
+	Name        string `json:"name"`
+	NodePool    string `json:"node_pool"`
+	Zone        string `json:"zone"`
+	Preemptible bool   `json:"preemptible"`
+}
+
+//
+type PayloadPod struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+//
+type PayloadEviction struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Outcome   string `json:"outcome"`
+}
+
+//
+type hookFile struct {
+	Hooks []*Hook `json:"hooks"`
+}
+
+// Runner calls the hooks around the drain, and keeps the results of the current run.
+type Runner struct {
+	hooks   []*Hook
+	mu      sync.Mutex
+	runID   string
+	results []*Result
+}
+
+// LoadHooks reads the hooks from the YAML file:
+//
+//	hooks:
+//	- name: handoff-leader
+//	  phase: pre-drain
+//	  mode: veto
+//	  timeout: 30s
+//	  http:
+//	    url: http://leader-election.default.svc/handoff
+//	- name: flush-cache
+//	  phase: post-drain
+//	  exec:
+//	    command: ["/hooks/flush-cache.sh"]
+func LoadHooks(path string) ([]*Hook, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks %s: %s", path, err)
+	}
+	var in hookFile
+	if err := yaml.UnmarshalStrict(b, &in); err != nil {
+		return nil, fmt.Errorf("failed to parse hooks %s: %s", path, err)
+	}
+	for i, v := range in.Hooks {
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("invalid hook at %d: %s", i, err)
+		}
+	}
+	return in.Hooks, nil
+}
+
+//
+func (h *Hook) validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch h.Phase {
+	case PhasePreDrain, PhasePostDrain:
+	default:
+		return fmt.Errorf("phase of hook %s must be %s or %s: %s", h.Name, PhasePreDrain, PhasePostDrain, h.Phase)
+	}
+	switch h.Mode {
+	case "":
+		h.Mode = ModeAdvise
+	case ModeVeto, ModeAdvise:
+	default:
+		return fmt.Errorf("mode of hook %s must be %s or %s: %s", h.Name, ModeVeto, ModeAdvise, h.Mode)
+	}
+	if (h.HTTP == nil) == (h.Exec == nil) {
+		return fmt.Errorf("hook %s must have either http or exec", h.Name)
+	}
+	if h.HTTP != nil && h.HTTP.URL == "" {
+		return fmt.Errorf("url of hook %s is required", h.Name)
+	}
+	if h.Exec != nil && len(h.Exec.Command) == 0 {
+		return fmt.Errorf("command of hook %s is required", h.Name)
+	}
+	h.timeout = DefaultTimeout
+	if h.Timeout != "" {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil {
+			return fmt.Errorf("failed to parse timeout of hook %s: %s", h.Name, err)
+		}
+		h.timeout = timeout
+	}
+	return nil
+}
+
+// NewRunner returns the runner of the hooks.
+func NewRunner(hooks []*Hook) *Runner {
+	return &Runner{hooks: hooks}
+}
+
+// Begin resets the results, and sets the run ID passed to the hooks.
+func (r *Runner) Begin(runID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runID = runID
+	r.results = nil
+}
+
+// Results returns the results of the hooks since Begin.
+func (r *Runner) Results() []*Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Result(nil), r.results...)
+}
+
+// BeforeDrain calls the pre-drain hooks, and returns the error if any veto hook failed.
+func (r *Runner) BeforeDrain(ctx context.Context, node *gke.Node) error {
+	vetoes := make([]string, 0, len(r.hooks))
+	for _, v := range r.run(ctx, PhasePreDrain, node, nil, nil) {
+		if v.Vetoed() {
+			vetoes = append(vetoes, fmt.Sprintf("%s: %s", v.Name, v.Err))
+		}
+	}
+	if len(vetoes) > 0 {
+		return fmt.Errorf("hooks failed: %s", strings.Join(vetoes, ", "))
+	}
+	return nil
+}
+
+// AfterDrain calls the post-drain hooks.
+func (r *Runner) AfterDrain(ctx context.Context, node *gke.Node, evictions []*gke.Eviction, err error) {
+	r.run(ctx, PhasePostDrain, node, evictions, err)
+}
+
+//
+func (r *Runner) run(ctx context.Context, phase Phase, node *gke.Node, evictions []*gke.Eviction, drainErr error) []*Result {
+	r.mu.Lock()
+	payload := newPayload(r.runID, phase, node, evictions, drainErr)
+	r.mu.Unlock()
+	results := make([]*Result, 0, len(r.hooks))
+	for _, v := range r.hooks {
+		if v.Phase != phase {
+			continue
+		}
+		result := v.call(ctx, node, payload)
+		logger := log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool})
+		if result.Err != nil {
+			logger.Warnf("Failed to call %s hook %s (mode=%s) for node %s: %s", phase, v.Name, v.Mode, node.Name, result.Err)
+		} else {
+			logger.Infof("Succeeded in call %s hook %s for node %s", phase, v.Name, node.Name)
+		}
+		results = append(results, result)
+	}
+	r.mu.Lock()
+	r.results = append(r.results, results...)
+	r.mu.Unlock()
+	return results
+}
+
+//
+func (h *Hook) call(ctx context.Context, node *gke.Node, payload *Payload) *Result {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	start := time.Now()
+	var output string
+	var err error
+	if h.HTTP != nil {
+		output, err = h.HTTP.call(ctx, payload)
+	} else {
+		output, err = h.Exec.call(ctx, payload)
+	}
+	if len(output) > OutputMaxLength {
+		output = output[:OutputMaxLength]
+	}
+	return &Result{
+		Name:     h.Name,
+		Phase:    h.Phase,
+		Mode:     h.Mode,
+		NodeName: node.Name,
+		Duration: time.Since(start),
+		Output:   strings.TrimSpace(output),
+		Err:      err,
+	}
+}
+
+//
+func newPayload(runID string, phase Phase, node *gke.Node, evictions []*gke.Eviction, err error) *Payload {
+	payload := &Payload{
+		RunID:       runID,
+		Phase:       phase,
+		ClusterName: node.ClusterName,
+		Node: PayloadNode{
+			Name:        node.Name,
+			NodePool:    node.NodePool,
+			Zone:        node.Zone,
+			Preemptible: node.Preemptible,
+		},
+		Pods: make([]PayloadPod, 0, len(node.Pods)),
+	}
+	for _, v := range node.Pods {
+		payload.Pods = append(payload.Pods, PayloadPod{Name: v.Name, Namespace: v.Namespace})
+	}
+	for _, v := range evictions {
+		payload.Evictions = append(payload.Evictions, PayloadEviction{Name: v.Pod.Name, Namespace: v.Pod.Namespace, Outcome: string(v.Outcome)})
+	}
+	if err != nil {
+		payload.Error = err.Error()
+	}
+	return payload
+}
@@ -5,117 +5,337 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	FieldNode      = "node"
+	FieldPool      = "pool"
+	FieldPod       = "pod"
+	FieldNamespace = "namespace"
+	FieldRunID     = "run_id"
+)
+
 //
-type Logger struct {
-	raw *log.Logger
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+//
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARNING", "WARN":
+		return LevelWarning, nil
+	case "ERROR":
+		return LevelError, nil
+	}
+	return LevelDebug, fmt.Errorf("unknown level: %s", s)
 }
 
 //
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarning:
+		return "WARNING"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", int(l))
+}
+
+// Fields are emitted as the keys of jsonPayload.
+type Fields map[string]interface{}
+
+//
+type Logger struct {
+	raw    *log.Logger
+	config *config
+	fields Fields
+}
+
+// config is shared by the logger and the loggers derived from it.
+type config struct {
+	mu       sync.RWMutex
+	minLevel Level
+	labels   map[string]string
+	trace    string
+	spanID   string
+	runID    string
+}
+
+// Entry is compatible with the special fields of Cloud Logging.
+// See https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
 type Entry struct {
-	Time     string `json:"time"`
-	Severity string `json:"severity"`
-	Message  string `json:"message"`
+	Time           string            `json:"time"`
+	Severity       string            `json:"severity"`
+	Message        string            `json:"message"`
+	Labels         map[string]string `json:"logging.googleapis.com/labels,omitempty"`
+	SourceLocation *SourceLocation   `json:"logging.googleapis.com/sourceLocation,omitempty"`
+	Trace          string            `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID         string            `json:"logging.googleapis.com/spanId,omitempty"`
+	Fields         Fields            `json:"-"`
+}
+
+//
+type SourceLocation struct {
+	File     string `json:"file"`
+	Line     string `json:"line"`
+	Function string `json:"function"`
 }
 
 //
-var defaultLogger = New(log.New(os.Stdout, "", 0))
+var defaultLogger = New(log.New(os.Stderr, "", 0))
 
 //
 func New(raw *log.Logger) *Logger {
-	return &Logger{raw: raw}
+	return &Logger{
+		raw:    raw,
+		config: &config{minLevel: LevelDebug},
+	}
+}
+
+// MarshalJSON merges the fields into the top level keys.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry // avoid recursion
+	b, err := json.Marshal(entry(e))
+	if err != nil || len(e.Fields) == 0 {
+		return b, err
+	}
+	out := make(map[string]interface{}, len(e.Fields)+8)
+	for k, v := range e.Fields {
+		out[k] = v
+	}
+	if err := json.Unmarshal(b, &out); err != nil { // the entry keys take precedence over the fields
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+//
+func SetLevel(level Level) {
+	defaultLogger.SetLevel(level)
+}
+
+// SetLabel sets the label which is emitted to all entries of the default logger.
+func SetLabel(key, value string) {
+	defaultLogger.SetLabel(key, value)
+}
+
+// SetTrace sets the trace which is emitted to all entries of the default logger.
+func SetTrace(projectID, traceID, spanID string) {
+	defaultLogger.SetTrace(projectID, traceID, spanID)
+}
+
+// SetRunID sets the run ID to the label and the field which are emitted to all entries of the default logger.
+func SetRunID(runID string) {
+	defaultLogger.SetRunID(runID)
+}
+
+// WithFields returns the default logger with the fields.
+func WithFields(fields Fields) *Logger {
+	return defaultLogger.WithFields(fields)
 }
 
 //
 func Error(msg string) {
-	defaultLogger.Error(msg)
+	defaultLogger.write(LevelError, msg)
 }
 
 //
 func Errorf(format string, a ...interface{}) {
-	defaultLogger.Errorf(format, a...)
+	defaultLogger.write(LevelError, fmt.Sprintf(format, a...))
 }
 
 //
 func Warn(msg string) {
-	defaultLogger.Warn(msg)
+	defaultLogger.write(LevelWarning, msg)
 }
 
 //
 func Warnf(format string, a ...interface{}) {
-	defaultLogger.Warnf(format, a...)
+	defaultLogger.write(LevelWarning, fmt.Sprintf(format, a...))
 }
 
 //
 func Info(msg string) {
-	defaultLogger.Info(msg)
+	defaultLogger.write(LevelInfo, msg)
 }
 
 //
 func Infof(format string, a ...interface{}) {
-	defaultLogger.Infof(format, a...)
+	defaultLogger.write(LevelInfo, fmt.Sprintf(format, a...))
 }
 
 //
 func Debug(msg string) {
-	defaultLogger.Debug(msg)
+	defaultLogger.write(LevelDebug, msg)
 }
 
 //
 func Debugf(format string, a ...interface{}) {
-	defaultLogger.Debugf(format, a...)
+	defaultLogger.write(LevelDebug, fmt.Sprintf(format, a...))
+}
+
+//
+func (l *Logger) SetLevel(level Level) {
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.minLevel = level
+}
+
+//
+func (l *Logger) SetLabel(key, value string) {
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	labels := make(map[string]string, len(l.config.labels)+1)
+	for k, v := range l.config.labels {
+		labels[k] = v
+	}
+	labels[key] = value
+	l.config.labels = labels
+}
+
+// SetRunID sets the run ID to the label and the field, which is shared with the derived loggers.
+func (l *Logger) SetRunID(runID string) {
+	l.SetLabel(FieldRunID, runID)
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.runID = runID
+}
+
+//
+func (l *Logger) SetTrace(projectID, traceID, spanID string) {
+	l.config.mu.Lock()
+	defer l.config.mu.Unlock()
+	l.config.trace = ""
+	if traceID != "" {
+		l.config.trace = fmt.Sprintf("projects/%s/traces/%s", projectID, traceID)
+	}
+	l.config.spanID = spanID
+}
+
+// WithFields returns the derived logger with the fields.
+func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{
+		raw:    l.raw,
+		config: l.config,
+		fields: merged,
+	}
 }
 
 //
 func (l *Logger) Error(msg string) {
-	l.Write("ERROR", msg)
+	l.write(LevelError, msg)
 }
 
 //
 func (l *Logger) Errorf(format string, a ...interface{}) {
-	l.Write("ERROR", fmt.Sprintf(format, a...))
+	l.write(LevelError, fmt.Sprintf(format, a...))
 }
 
 //
 func (l *Logger) Warn(msg string) {
-	l.Write("WARNING", msg)
+	l.write(LevelWarning, msg)
 }
 
 //
 func (l *Logger) Warnf(format string, a ...interface{}) {
-	l.Write("WARNING", fmt.Sprintf(format, a...))
+	l.write(LevelWarning, fmt.Sprintf(format, a...))
 }
 
 //
 func (l *Logger) Info(msg string) {
-	l.Write("INFO", msg)
+	l.write(LevelInfo, msg)
 }
 
 //
 func (l *Logger) Infof(format string, a ...interface{}) {
-	l.Write("INFO", fmt.Sprintf(format, a...))
+	l.write(LevelInfo, fmt.Sprintf(format, a...))
 }
 
 //
 func (l *Logger) Debug(msg string) {
-	l.Write("DEBUG", msg)
+	l.write(LevelDebug, msg)
 }
 
 //
 func (l *Logger) Debugf(format string, a ...interface{}) {
-	l.Write("DEBUG", fmt.Sprintf(format, a...))
+	l.write(LevelDebug, fmt.Sprintf(format, a...))
 }
 
 //
 func (l *Logger) Write(severity, msg string) {
+	level, err := ParseLevel(severity)
+	if err != nil {
+		level = LevelInfo
+	}
+	l.write(level, msg)
+}
+
+// write must be called directly by the exported function to resolve the source location.
+func (l *Logger) write(level Level, msg string) {
+	l.config.mu.RLock()
+	minLevel, labels, trace, spanID, runID := l.config.minLevel, l.config.labels, l.config.trace, l.config.spanID, l.config.runID
+	l.config.mu.RUnlock()
+	if level < minLevel {
+		return
+	}
+	fields := l.fields
+	if _, ok := fields[FieldRunID]; !ok && runID != "" {
+		fields = make(Fields, len(l.fields)+1)
+		for k, v := range l.fields {
+			fields[k] = v
+		}
+		fields[FieldRunID] = runID
+	}
 	now := time.Now().Format(time.RFC3339Nano)
 	entry := Entry{
-		Time:     now,
-		Severity: severity,
-		Message:  msg,
+		Time:           now,
+		Severity:       level.String(),
+		Message:        msg,
+		Labels:         labels,
+		SourceLocation: sourceLocation(3), // skip sourceLocation, write and the exported function
+		Trace:          trace,
+		SpanID:         spanID,
+		Fields:         fields,
 	}
 	b, _ := json.Marshal(entry)
 	l.raw.Print(string(b))
 }
+
+//
+func sourceLocation(skip int) *SourceLocation {
+	pc := make([]uintptr, 1)
+	if runtime.Callers(skip+1, pc) == 0 {
+		return nil
+	}
+	frame, _ := runtime.CallersFrames(pc).Next()
+	return &SourceLocation{
+		File:     frame.File,
+		Line:     fmt.Sprintf("%d", frame.Line),
+		Function: frame.Function,
+	}
+}
@@ -2,28 +2,89 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/na-ga/gke-node-optimizer/consolidation"
+	"github.com/na-ga/gke-node-optimizer/cost"
 	"github.com/na-ga/gke-node-optimizer/gke"
+	"github.com/na-ga/gke-node-optimizer/history"
+	"github.com/na-ga/gke-node-optimizer/hook"
 	"github.com/na-ga/gke-node-optimizer/log"
 	"github.com/na-ga/gke-node-optimizer/report"
 	"github.com/na-ga/gke-node-optimizer/service"
+	"github.com/na-ga/gke-node-optimizer/tracing"
 
+	"github.com/google/uuid"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type (
 	//
 	configuration struct {
-		ProjectID                     string `envconfig:"PROJECT_ID" required:"true"`
-		ClusterName                   string `envconfig:"CLUSTER_NAME" required:"true"`
-		ClusterLocation               string `envconfig:"CLUSTER_LOCATION" required:"true"`
-		UseLocalKubeConfig            bool   `envconfig:"USE_LOCAL_KUBE_CONFIG" default:"false"`
-		MinimumPreemptibleNodeCount   int    `envconfig:"MINIMUM_PREEMPTIBLE_NODE_COUNT"`
-		OptimizePreemptibleNode       bool   `envconfig:"OPTIMIZE_PREEMPTIBLE_NODE" default:"true"`
-		OptimizeAutoscaleOndemandNode bool   `envconfig:"OPTIMIZE_AUTOSCALE_ONDEMAND_NODE" default:"true"`
-		SlackBotToken                 string `envconfig:"SLACK_BOT_TOKEN"`
-		SlackChannelID                string `envconfig:"SLACK_CHANNEL_ID"`
+		ProjectID                     string            `envconfig:"PROJECT_ID"`
+		ClusterName                   string            `envconfig:"CLUSTER_NAME"`
+		ClusterLocation               string            `envconfig:"CLUSTER_LOCATION"`
+		LogLevel                      string            `envconfig:"LOG_LEVEL" default:"info"`
+		UseLocalKubeConfig            bool              `envconfig:"USE_LOCAL_KUBE_CONFIG" default:"false"`
+		APIRetryMaxAttempts           int               `envconfig:"API_RETRY_MAX_ATTEMPTS" default:"5"`
+		APIRetryInitialInterval       time.Duration     `envconfig:"API_RETRY_INITIAL_INTERVAL" default:"1s"`
+		APIRetryMaxInterval           time.Duration     `envconfig:"API_RETRY_MAX_INTERVAL" default:"30s"`
+		EvictionMaxAttempts           int               `envconfig:"EVICTION_MAX_ATTEMPTS" default:"3"`
+		EvictionRetryInterval         time.Duration     `envconfig:"EVICTION_RETRY_INTERVAL" default:"30s"`
+		EvictionMaxRetryInterval      time.Duration     `envconfig:"EVICTION_MAX_RETRY_INTERVAL" default:"5m"`
+		PodGracePeriod                time.Duration     `envconfig:"POD_GRACE_PERIOD" default:"0"`
+		PodDeletionTimeout            time.Duration     `envconfig:"POD_DELETION_TIMEOUT" default:"0"`
+		ForceDeleteNamespaces         []string          `envconfig:"FORCE_DELETE_NAMESPACES"`
+		EvictionReadinessTimeout      time.Duration     `envconfig:"EVICTION_READINESS_TIMEOUT" default:"5m"`
+		RestartSingleReplica          bool              `envconfig:"RESTART_SINGLE_REPLICA_DEPLOYMENTS" default:"false"`
+		DisruptionPolicy              string            `envconfig:"DISRUPTION_POLICY" default:"evict"`
+		DisruptionNamespacePolicies   map[string]string `envconfig:"DISRUPTION_NAMESPACE_POLICIES"`
+		DisruptionWaitTimeout         time.Duration     `envconfig:"DISRUPTION_WAIT_TIMEOUT" default:"30m"`
+		PreDrainTaint                 string            `envconfig:"PRE_DRAIN_TAINT"`
+		PreDrainPeriod                time.Duration     `envconfig:"PRE_DRAIN_PERIOD" default:"0"`
+		HooksPath                     string            `envconfig:"HOOKS_PATH"`
+		RecordKubernetesEvents        bool              `envconfig:"RECORD_KUBERNETES_EVENTS" default:"true"`
+		MinimumPreemptibleNodeCount   int               `envconfig:"MINIMUM_PREEMPTIBLE_NODE_COUNT"`
+		OptimizePreemptibleNode       bool              `envconfig:"OPTIMIZE_PREEMPTIBLE_NODE" default:"true"`
+		OptimizeAutoscaleOndemandNode bool              `envconfig:"OPTIMIZE_AUTOSCALE_ONDEMAND_NODE" default:"true"`
+		ConsolidationMaxNodes         int               `envconfig:"CONSOLIDATION_MAX_NODES" default:"0"`
+		ConsolidationThreshold        int               `envconfig:"CONSOLIDATION_UTILIZATION_THRESHOLD" default:"50"`
+		CheckPreemptibleCapacity      bool              `envconfig:"CHECK_PREEMPTIBLE_CAPACITY" default:"true"`
+		MaxNotReadyNodes              int               `envconfig:"MAX_NOT_READY_NODES" default:"0"`
+		MaxNotReadyNodePercent        int               `envconfig:"MAX_NOT_READY_NODE_PERCENT" default:"0"`
+		MaxNotRunningNodePools        int               `envconfig:"MAX_NOT_RUNNING_NODE_POOLS" default:"0"`
+		MaxNotRunningNodePoolPercent  int               `envconfig:"MAX_NOT_RUNNING_NODE_POOL_PERCENT" default:"0"`
+		ReplacementTimeout            time.Duration     `envconfig:"REPLACEMENT_TIMEOUT" default:"10m"`
+		PriceTablePath                string            `envconfig:"PRICE_TABLE_PATH"`
+		CostEstimationPeriod          time.Duration     `envconfig:"COST_ESTIMATION_PERIOD" default:"30m"`
+		CostLedgerPath                string            `envconfig:"COST_LEDGER_PATH"`
+		HistoryStore                  string            `envconfig:"HISTORY_STORE"`
+		HistoryMaxRecords             int               `envconfig:"HISTORY_MAX_RECORDS" default:"500"`
+		HistoryStorageEndpoint        string            `envconfig:"HISTORY_STORAGE_ENDPOINT"`
+		SlackBotToken                 string            `envconfig:"SLACK_BOT_TOKEN"`
+		SlackChannelID                string            `envconfig:"SLACK_CHANNEL_ID"`
+		SlackReportSeverity           string            `envconfig:"SLACK_REPORT_SEVERITY" default:"info"`
+		LogReportSeverity             string            `envconfig:"LOG_REPORT_SEVERITY"`
+		ReportOutputs                 []string          `envconfig:"REPORT_OUTPUTS"`
+		ReportOutputSeverity          string            `envconfig:"REPORT_OUTPUT_SEVERITY" default:"info"`
+		OTLPEndpoint                  string            `envconfig:"OTLP_ENDPOINT"`
+		OTLPInsecure                  bool              `envconfig:"OTLP_INSECURE" default:"false"`
+		DaemonInterval                time.Duration     `envconfig:"DAEMON_INTERVAL" default:"0"`
+		CacheResync                   time.Duration     `envconfig:"CACHE_RESYNC" default:"10m"`
+		ShutdownGracePeriod           time.Duration     `envconfig:"SHUTDOWN_GRACE_PERIOD" default:"30s"`
+		NodeName                      string            `envconfig:"NODE_NAME"`
+		MetadataEndpoint              string            `envconfig:"METADATA_ENDPOINT" default:"http://metadata.google.internal"`
+		AgentPollInterval             time.Duration     `envconfig:"AGENT_POLL_INTERVAL" default:"1s"`
+		AgentDrainTimeout             time.Duration     `envconfig:"AGENT_DRAIN_TIMEOUT" default:"25s"`
+		Output                        string            `ignored:"true"` // set by the flag only
+		AllManaged                    bool              `ignored:"true"` // set by the flag only
 	}
 )
 
@@ -33,52 +94,370 @@ const (
 
 //
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run parses the command and its flags, and returns the exit code, so that deferred functions are executed before exit.
+func run(args []string) int {
 
 	//
 	var conf configuration
 	if err := envconfig.Process(envPrefix, &conf); err != nil {
 		log.Errorf("Failed to process env var: %s", err)
-		os.Exit(1)
+		return 1
 	}
 
 	//
-	result := report.NewResult(conf.ProjectID)
-	var reporter report.Reporter
-	if conf.SlackBotToken == "" || conf.SlackChannelID == "" {
-		reporter = report.NewReporter()
-	} else {
-		reporter = report.NewSlackReporter(conf.SlackBotToken, conf.SlackChannelID)
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return 0
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", name)
+		printUsage()
+		return 2
+	}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s\n\n%s\n\nFlags:\n", commandName, cmd.usage, cmd.description)
+		flags.PrintDefaults()
+	}
+	bindCommonFlags(flags, &conf, cmd.output)
+	if cmd.flags != nil {
+		cmd.flags(flags, &conf)
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
 	}
 
 	//
-	ctx := context.Background()
-	gkeClient, err := gke.New(ctx, conf.ProjectID, conf.ClusterName, conf.ClusterLocation, conf.UseLocalKubeConfig)
+	level, err := log.ParseLevel(conf.LogLevel)
 	if err != nil {
-		log.Errorf("Failed to create gke client: %s", err)
-		if e := reporter.Report(result.SetError(err)); e != nil {
-			log.Errorf("Failed to post error report: %s", e)
+		log.Errorf("Failed to parse log level: %s", err)
+		return 1
+	}
+	log.SetLevel(level)
+	if err := conf.validate(cmd.requireCluster); err != nil {
+		log.Errorf("Invalid configuration: %s", err)
+		return 2
+	}
+
+	// cancel the context by the first signal, and kill the process by the second signal
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warnf("Received signal %s, aborting within %s", sig, conf.ShutdownGracePeriod)
+			signal.Stop(signals)
+			cancel()
+		case <-done:
 		}
-		os.Exit(1)
+	}()
+	return cmd.run(ctx, conf, flags.Args())
+}
+
+// validate returns the error if the required settings are not specified by the env vars or the flags.
+func (c configuration) validate(requireCluster bool) error {
+	switch c.Output {
+	case "", outputTable, outputJSON:
+	default:
+		return fmt.Errorf("unknown output format: %s", c.Output)
+	}
+	if _, err := c.disruptionOption(); err != nil {
+		return err
+	}
+	if !requireCluster {
+		return nil
+	}
+	if c.ProjectID == "" {
+		return fmt.Errorf("PROJECT_ID or --project is required")
 	}
+	if c.ClusterName == "" {
+		return fmt.Errorf("CLUSTER_NAME or --cluster is required")
+	}
+	if c.ClusterLocation == "" {
+		return fmt.Errorf("CLUSTER_LOCATION or --location is required")
+	}
+	return nil
+}
 
-	//
-	log.Info("Start gke node optimizer")
-	option := service.OptimizerOption{
+// disruptionOption returns the policy of the running jobs and the pods annotated not to be disrupted.
+func (c configuration) disruptionOption() (gke.DisruptionOption, error) {
+	policy, err := gke.ParseDisruptionPolicy(c.DisruptionPolicy)
+	if err != nil {
+		return gke.DisruptionOption{}, err
+	}
+	namespacePolicies, err := gke.ParseNamespaceDisruptionPolicies(c.DisruptionNamespacePolicies)
+	if err != nil {
+		return gke.DisruptionOption{}, err
+	}
+	return gke.DisruptionOption{
+		Policy:            policy,
+		NamespacePolicies: namespacePolicies,
+		WaitTimeout:       c.DisruptionWaitTimeout,
+	}, nil
+}
+
+// newGKEClient returns the gke client. The cache is used only if the optimizer runs as a daemon.
+// The hooks are called around the drain if not nil.
+func newGKEClient(ctx context.Context, conf configuration, useCache bool, hooks *hook.Runner) (gke.Client, error) {
+	clientOption := gke.ClientOption{
+		UseLocalConfig: conf.UseLocalKubeConfig,
+		RecordEvents:   conf.RecordKubernetesEvents,
+		Retry: gke.RetryOption{
+			MaxAttempts:     conf.APIRetryMaxAttempts,
+			InitialInterval: conf.APIRetryInitialInterval,
+			MaxInterval:     conf.APIRetryMaxInterval,
+		},
+		Eviction: gke.EvictionOption{
+			MaxAttempts:           conf.EvictionMaxAttempts,
+			RetryInterval:         conf.EvictionRetryInterval,
+			MaxRetryInterval:      conf.EvictionMaxRetryInterval,
+			GracePeriod:           conf.PodGracePeriod,
+			DeletionTimeout:       conf.PodDeletionTimeout,
+			ForceDeleteNamespaces: conf.ForceDeleteNamespaces,
+			ReadinessTimeout:      conf.EvictionReadinessTimeout,
+			RestartSingleReplica:  conf.RestartSingleReplica,
+		},
+		UseCache:       useCache,
+		CacheResync:    conf.CacheResync,
+		CleanupTimeout: conf.ShutdownGracePeriod,
+		PreDrainPeriod: conf.PreDrainPeriod,
+	}
+	if conf.PreDrainTaint != "" {
+		taint, err := gke.ParseTaint(conf.PreDrainTaint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pre-drain taint: %s", err)
+		}
+		clientOption.PreDrainTaint = taint
+	}
+	if hooks != nil {
+		clientOption.DrainHook = hooks
+	}
+	disruption, err := conf.disruptionOption()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse disruption policy: %s", err)
+	}
+	clientOption.Disruption = disruption
+	return gke.New(ctx, conf.ProjectID, conf.ClusterName, conf.ClusterLocation, clientOption)
+}
+
+// newHookRunner returns the runner of the drain hooks, or nil if not configured.
+func newHookRunner(conf configuration) (*hook.Runner, error) {
+	if conf.HooksPath == "" {
+		return nil, nil
+	}
+	hooks, err := hook.LoadHooks(conf.HooksPath)
+	if err != nil {
+		return nil, err
+	}
+	return hook.NewRunner(hooks), nil
+}
+
+// newHistoryStore returns the history store, or nil if not configured.
+func newHistoryStore(ctx context.Context, conf configuration) (history.Store, error) {
+	if conf.HistoryStore == "" {
+		return nil, nil
+	}
+	return history.NewStore(ctx, conf.HistoryStore, history.StoreOption{
+		MaxRecords:         conf.HistoryMaxRecords,
+		UseLocalKubeConfig: conf.UseLocalKubeConfig,
+		StorageEndpoint:    conf.HistoryStorageEndpoint,
+	})
+}
+
+// newEstimator returns the estimator, or nil if not configured.
+func newEstimator(conf configuration) (*cost.Estimator, error) {
+	if conf.PriceTablePath == "" {
+		return nil, nil
+	}
+	prices, err := cost.LoadPriceTable(conf.PriceTablePath)
+	if err != nil {
+		return nil, err
+	}
+	return cost.NewEstimator(prices, conf.CostEstimationPeriod, conf.CostLedgerPath), nil
+}
+
+// newOptimizerOption returns the optimizer option by the configuration.
+func newOptimizerOption(conf configuration) service.OptimizerOption {
+	disruption, _ := conf.disruptionOption() // validated
+	return service.OptimizerOption{
 		MinimumPreemptibleNodeCount:   conf.MinimumPreemptibleNodeCount,
 		OptimizePreemptibleNode:       conf.OptimizePreemptibleNode,
 		OptimizeAutoscaleOndemandNode: conf.OptimizeAutoscaleOndemandNode,
+		ReplacementTimeout:            conf.ReplacementTimeout,
+		CheckPreemptibleCapacity:      conf.CheckPreemptibleCapacity,
+		Disruption:                    disruption,
+		Consolidation: consolidation.Option{
+			MaxNodes:             conf.ConsolidationMaxNodes,
+			UtilizationThreshold: conf.ConsolidationThreshold,
+		},
+		HealthGate: service.HealthGateOption{
+			MaxNotReadyNodes:             conf.MaxNotReadyNodes,
+			MaxNotReadyNodePercent:       conf.MaxNotReadyNodePercent,
+			MaxNotRunningNodePools:       conf.MaxNotRunningNodePools,
+			MaxNotRunningNodePoolPercent: conf.MaxNotRunningNodePoolPercent,
+		},
+	}
+}
+
+// optimize runs the optimizer once, and returns the exit code.
+func optimize(ctx context.Context, conf configuration, gkeClient gke.Client, reporter report.Reporter, estimator *cost.Estimator, store history.Store, hooks *hook.Runner) int {
+
+	//
+	log.Info("Start gke node optimizer")
+	result := newResult(conf)
+	option := newOptimizerOption(conf)
+	option.Estimator = estimator
+	if hooks != nil {
+		hooks.Begin(result.RunID())
+	}
+	err := service.NewOptimizer(gkeClient, result, option).Optimize(ctx)
+	if hooks != nil {
+		result.HookResults = hooks.Results()
 	}
-	if err := service.NewOptimizer(gkeClient, result, option).Optimize(ctx); err != nil {
-		log.Errorf("Failed to gke node optimizer: %s", err)
-		if e := reporter.Report(result.SetError(err)); e != nil {
+	if err != nil {
+		message := fmt.Sprintf("Failed to optimize gke cluster nodes: %s", err)
+		if ctx.Err() != nil {
+			log.Warnf("Aborted gke node optimizer: %s", err)
+			result.Aborted = true
+			message = fmt.Sprintf("Aborted to optimize gke cluster nodes: %s", err)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(tracing.Detach(ctx), conf.ShutdownGracePeriod) // report within the grace period
+			defer cancel()
+		} else {
+			log.Errorf("Failed to gke node optimizer: %s", err)
+		}
+		if e := gkeClient.RecordSummaryEvent(ctx, true, message); e != nil {
+			log.Errorf("Failed to record summary event: %s", e)
+		}
+		recordHistory(ctx, store, result.SetError(err))
+		if e := reporter.Report(result.Finish()); e != nil {
 			log.Errorf("Failed to post error report: %s", e)
 		}
-		os.Exit(1)
+		printResult(conf.Output, result, printSummary)
+		return 1
 	}
 
 	//
 	log.Info("Succeeded in gke node optimizer")
-	if err := reporter.Report(result); err != nil {
+	if err := gkeClient.RecordSummaryEvent(ctx, false, summaryMessage(result)); err != nil {
+		log.Errorf("Failed to record summary event: %s", err)
+	}
+	recordHistory(ctx, store, result)
+	if err := reporter.Report(result.Finish()); err != nil {
 		log.Errorf("Failed to post success report: %s", err)
 	}
+	printResult(conf.Output, result, printSummary)
+	return 0
+}
+
+// recordHistory appends the record of the result to the history store, and sets the trend including the result.
+// The failure is only logged because the history is informational.
+func recordHistory(ctx context.Context, store history.Store, result *report.Result) {
+	if store == nil {
+		return
+	}
+	if err := store.Append(ctx, history.NewRecord(result.Finish())); err != nil {
+		log.Errorf("Failed to append history: %s", err)
+		return
+	}
+	records, err := store.List(ctx)
+	if err != nil {
+		log.Errorf("Failed to list history: %s", err)
+		return
+	}
+	result.Trend = history.NewTrend(records)
+}
+
+// newResult returns the result with the new run ID.
+func newResult(conf configuration) *report.Result {
+	runID := uuid.New().String()
+	log.SetRunID(runID)
+	return report.NewResult(conf.ProjectID, runID)
+}
+
+//
+func summaryMessage(result *report.Result) string {
+	if result.DeferredReason != "" {
+		return fmt.Sprintf("Deferred optimize gke cluster nodes: %s", result.DeferredReason)
+	}
+	targets := make([]string, 0, 2)
+	if result.TargetPreemptibleNode != nil {
+		targets = append(targets, result.TargetPreemptibleNode.Name)
+	}
+	for _, v := range result.GetTargetOndemandAutoscaleNodes() {
+		targets = append(targets, v.Name)
+	}
+	if len(targets) == 0 {
+		return "Succeeded in optimize gke cluster nodes: refresh target node does not exist"
+	}
+	return fmt.Sprintf("Succeeded in optimize gke cluster nodes: refreshed=%s, evictedPods=%d", strings.Join(targets, ","), len(result.EvictedPods))
+}
+
+//
+func newReporter(conf configuration) (report.Reporter, error) {
+	sinks := make([]report.Sink, 0, 2+len(conf.ReportOutputs))
+	if conf.SlackBotToken != "" && conf.SlackChannelID != "" {
+		severity, err := report.ParseSeverity(conf.SlackReportSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse slack report severity: %s", err)
+		}
+		sinks = append(sinks, report.Sink{
+			Name:        "slack",
+			Reporter:    report.NewSlackReporter(conf.SlackBotToken, conf.SlackChannelID),
+			MinSeverity: severity,
+		})
+	}
+	if conf.LogReportSeverity != "" {
+		severity, err := report.ParseSeverity(conf.LogReportSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse log report severity: %s", err)
+		}
+		sinks = append(sinks, report.Sink{
+			Name:        "log",
+			Reporter:    report.NewLogReporter(),
+			MinSeverity: severity,
+		})
+	}
+	if len(conf.ReportOutputs) > 0 {
+		severity, err := report.ParseSeverity(conf.ReportOutputSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse report output severity: %s", err)
+		}
+		for _, v := range conf.ReportOutputs {
+			output := strings.SplitN(v, ":", 2) // format[:path]
+			format, err := report.ParseFormat(output[0])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse report output %s: %s", v, err)
+			}
+			path := report.StdoutPath
+			if len(output) > 1 {
+				path = output[1]
+			}
+			sinks = append(sinks, report.Sink{
+				Name:        fmt.Sprintf("%s:%s", format, path),
+				Reporter:    report.NewFileReporter(format, path),
+				MinSeverity: severity,
+			})
+		}
+	}
+	if len(sinks) == 0 {
+		return report.NewReporter(), nil
+	}
+	return report.NewMultiReporter(sinks...), nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+)
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("GNO_TEST_RUN_ARGS"); ok {
+		log.Info("Log written during the command")
+		os.Exit(run(filepath.SplitList(args)))
+	}
+	os.Exit(m.Run())
+}
+
+func TestJSONOutputHoldsOnlyDocument(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(),
+		"GNO_TEST_RUN_ARGS=history"+string(filepath.ListSeparator)+"--output=json",
+		envPrefix+"_HISTORY_STORE=file:"+filepath.Join(t.TempDir(), "history.jsonl"),
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("failed to run history command: %s: %s", err, stderr.String())
+	}
+	dec := json.NewDecoder(&stdout)
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatalf("stdout is not a json document: %s", err)
+	}
+	if _, ok := doc["records"]; !ok {
+		t.Errorf("stdout is not the history document: %v", doc)
+	}
+	if dec.More() {
+		t.Errorf("stdout holds more than the document")
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("Log written during the command")) {
+		t.Errorf("log is not written to stderr: %s", stderr.String())
+	}
+	if bytes.Contains(stderr.Bytes(), []byte("Received signal")) {
+		t.Errorf("signal is logged without the signal: %s", stderr.String())
+	}
+}
@@ -9,6 +9,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	gke "github.com/na-ga/gke-node-optimizer/gke"
 	reflect "reflect"
+	time "time"
 )
 
 // MockClient is a mock of Client interface
@@ -79,71 +80,86 @@ func (mr *MockClientMockRecorder) GetNodePoolList(ctx interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodePoolList", reflect.TypeOf((*MockClient)(nil).GetNodePoolList), ctx)
 }
 
+// GetRunningOperationList mocks base method
+func (m *MockClient) GetRunningOperationList(ctx context.Context) ([]*gke.Operation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRunningOperationList", ctx)
+	ret0, _ := ret[0].([]*gke.Operation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRunningOperationList indicates an expected call of GetRunningOperationList
+func (mr *MockClientMockRecorder) GetRunningOperationList(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRunningOperationList", reflect.TypeOf((*MockClient)(nil).GetRunningOperationList), ctx)
+}
+
 // GetNode mocks base method
-func (m *MockClient) GetNode(nodeName string) (*gke.Node, error) {
+func (m *MockClient) GetNode(ctx context.Context, nodeName string) (*gke.Node, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetNode", nodeName)
+	ret := m.ctrl.Call(m, "GetNode", ctx, nodeName)
 	ret0, _ := ret[0].(*gke.Node)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetNode indicates an expected call of GetNode
-func (mr *MockClientMockRecorder) GetNode(nodeName interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetNode(ctx, nodeName interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNode", reflect.TypeOf((*MockClient)(nil).GetNode), nodeName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNode", reflect.TypeOf((*MockClient)(nil).GetNode), ctx, nodeName)
 }
 
 // GetNodeList mocks base method
-func (m *MockClient) GetNodeList() ([]*gke.Node, error) {
+func (m *MockClient) GetNodeList(ctx context.Context) ([]*gke.Node, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetNodeList")
+	ret := m.ctrl.Call(m, "GetNodeList", ctx)
 	ret0, _ := ret[0].([]*gke.Node)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetNodeList indicates an expected call of GetNodeList
-func (mr *MockClientMockRecorder) GetNodeList() *gomock.Call {
+func (mr *MockClientMockRecorder) GetNodeList(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeList", reflect.TypeOf((*MockClient)(nil).GetNodeList))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNodeList", reflect.TypeOf((*MockClient)(nil).GetNodeList), ctx)
 }
 
 // GetPod mocks base method
-func (m *MockClient) GetPod(podName string) (*gke.Pod, error) {
+func (m *MockClient) GetPod(ctx context.Context, podName string) (*gke.Pod, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPod", podName)
+	ret := m.ctrl.Call(m, "GetPod", ctx, podName)
 	ret0, _ := ret[0].(*gke.Pod)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPod indicates an expected call of GetPod
-func (mr *MockClientMockRecorder) GetPod(podName interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetPod(ctx, podName interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPod", reflect.TypeOf((*MockClient)(nil).GetPod), podName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPod", reflect.TypeOf((*MockClient)(nil).GetPod), ctx, podName)
 }
 
 // GetPodListByNodeName mocks base method
-func (m *MockClient) GetPodListByNodeName(nodeName string) ([]*gke.Pod, error) {
+func (m *MockClient) GetPodListByNodeName(ctx context.Context, nodeName string) ([]*gke.Pod, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPodListByNodeName", nodeName)
+	ret := m.ctrl.Call(m, "GetPodListByNodeName", ctx, nodeName)
 	ret0, _ := ret[0].([]*gke.Pod)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPodListByNodeName indicates an expected call of GetPodListByNodeName
-func (mr *MockClientMockRecorder) GetPodListByNodeName(nodeName interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetPodListByNodeName(ctx, nodeName interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodListByNodeName", reflect.TypeOf((*MockClient)(nil).GetPodListByNodeName), nodeName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodListByNodeName", reflect.TypeOf((*MockClient)(nil).GetPodListByNodeName), ctx, nodeName)
 }
 
 // RefreshNode mocks base method
-func (m *MockClient) RefreshNode(ctx context.Context, nodeName string) ([]*gke.Pod, error) {
+func (m *MockClient) RefreshNode(ctx context.Context, nodeName string) ([]*gke.Eviction, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "RefreshNode", ctx, nodeName)
-	ret0, _ := ret[0].([]*gke.Pod)
+	ret0, _ := ret[0].([]*gke.Eviction)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -155,10 +171,10 @@ func (mr *MockClientMockRecorder) RefreshNode(ctx, nodeName interface{}) *gomock
 }
 
 // RefreshNodes mocks base method
-func (m *MockClient) RefreshNodes(ctx context.Context, nodeNames []string) ([]*gke.Pod, error) {
+func (m *MockClient) RefreshNodes(ctx context.Context, nodeNames []string) ([]*gke.Eviction, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "RefreshNodes", ctx, nodeNames)
-	ret0, _ := ret[0].([]*gke.Pod)
+	ret0, _ := ret[0].([]*gke.Eviction)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -168,3 +184,91 @@ func (mr *MockClientMockRecorder) RefreshNodes(ctx, nodeNames interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshNodes", reflect.TypeOf((*MockClient)(nil).RefreshNodes), ctx, nodeNames)
 }
+
+// DrainNode mocks base method
+func (m *MockClient) DrainNode(ctx context.Context, nodeName string) ([]*gke.Eviction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DrainNode", ctx, nodeName)
+	ret0, _ := ret[0].([]*gke.Eviction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DrainNode indicates an expected call of DrainNode
+func (mr *MockClientMockRecorder) DrainNode(ctx, nodeName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DrainNode", reflect.TypeOf((*MockClient)(nil).DrainNode), ctx, nodeName)
+}
+
+// EvacuateNode mocks base method
+func (m *MockClient) EvacuateNode(ctx context.Context, nodeName string) ([]*gke.Eviction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EvacuateNode", ctx, nodeName)
+	ret0, _ := ret[0].([]*gke.Eviction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EvacuateNode indicates an expected call of EvacuateNode
+func (mr *MockClientMockRecorder) EvacuateNode(ctx, nodeName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EvacuateNode", reflect.TypeOf((*MockClient)(nil).EvacuateNode), ctx, nodeName)
+}
+
+// UncordonManagedNodes mocks base method
+func (m *MockClient) UncordonManagedNodes(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UncordonManagedNodes", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UncordonManagedNodes indicates an expected call of UncordonManagedNodes
+func (mr *MockClientMockRecorder) UncordonManagedNodes(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UncordonManagedNodes", reflect.TypeOf((*MockClient)(nil).UncordonManagedNodes), ctx)
+}
+
+// WaitForReplacementNode mocks base method
+func (m *MockClient) WaitForReplacementNode(ctx context.Context, nodePoolName string, expectedCount int, since time.Time, timeout time.Duration) (*gke.Node, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitForReplacementNode", ctx, nodePoolName, expectedCount, since, timeout)
+	ret0, _ := ret[0].(*gke.Node)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WaitForReplacementNode indicates an expected call of WaitForReplacementNode
+func (mr *MockClientMockRecorder) WaitForReplacementNode(ctx, nodePoolName, expectedCount, since, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForReplacementNode", reflect.TypeOf((*MockClient)(nil).WaitForReplacementNode), ctx, nodePoolName, expectedCount, since, timeout)
+}
+
+// Sync mocks base method
+func (m *MockClient) Sync(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sync", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Sync indicates an expected call of Sync
+func (mr *MockClientMockRecorder) Sync(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sync", reflect.TypeOf((*MockClient)(nil).Sync), ctx)
+}
+
+// RecordSummaryEvent mocks base method
+func (m *MockClient) RecordSummaryEvent(ctx context.Context, failed bool, message string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordSummaryEvent", ctx, failed, message)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordSummaryEvent indicates an expected call of RecordSummaryEvent
+func (mr *MockClientMockRecorder) RecordSummaryEvent(ctx, failed, message interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordSummaryEvent", reflect.TypeOf((*MockClient)(nil).RecordSummaryEvent), ctx, failed, message)
+}
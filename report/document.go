@@ -0,0 +1,458 @@
+package report
+
+import (
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/consolidation"
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+// DocumentVersion is the version of the document schema.
+// It must be incremented when an incompatible change is made to the document.
+const DocumentVersion = "v1"
+
+// Document is the serializable form of the result with the stable schema.
+type Document struct {
+	Version                     string               `json:"version"`
+	ProjectID                   string               `json:"project_id"`
+	RunID                       string               `json:"run_id"`
+	TraceID                     string               `json:"trace_id,omitempty"`
+	Hostname                    string               `json:"hostname"`
+	StartTime                   time.Time            `json:"start_time"`
+	EndTime                     time.Time            `json:"end_time"`
+	Severity                    string               `json:"severity"`
+	Succeeded                   bool                 `json:"succeeded"`
+	Aborted                     bool                 `json:"aborted"`
+	Error                       string               `json:"error,omitempty"`
+	DeferredReason              string               `json:"deferred_reason,omitempty"`
+	RunningOperations           []*OperationDocument `json:"running_operations"`
+	DetailLink                  string               `json:"detail_link,omitempty"`
+	Cluster                     *ClusterDocument     `json:"cluster,omitempty"`
+	PreemptibleNodeActualCount  int                  `json:"preemptible_node_actual_count"`
+	PreemptibleNodeMinimumCount int                  `json:"preemptible_node_minimum_count"`
+	ActiveNodePools             []*NodePoolDocument  `json:"active_node_pools"`
+	ActiveNodes                 []*NodeDocument      `json:"active_nodes"`
+	TargetPreemptibleNode       *NodeDocument        `json:"target_preemptible_node,omitempty"`
+	TargetOndemandAutoscaleNode *NodeDocument        `json:"target_ondemand_autoscale_node,omitempty"`
+	// TargetOndemandAutoscaleNodes is all on-demand targets, which are more than one by the consolidation.
+	TargetOndemandAutoscaleNodes []*NodeDocument          `json:"target_ondemand_autoscale_nodes"`
+	Consolidation                *ConsolidationDocument   `json:"consolidation,omitempty"`
+	OndemandSkippedReason        string                   `json:"ondemand_skipped_reason,omitempty"`
+	ProtectedNodes               []*ProtectedNodeDocument `json:"protected_nodes"`
+	ReplacementNode              *NodeDocument            `json:"replacement_node,omitempty"`
+	ReplacementFailure           string                   `json:"replacement_failure,omitempty"`
+	EvictedPods                  []*PodDocument           `json:"evicted_pods"`
+	EvictedWorkloads             []*WorkloadDocument      `json:"evicted_workloads"`
+	Evictions                    []*EvictionDocument      `json:"evictions"`
+	Hooks                        []*HookDocument          `json:"hooks"`
+	ToleratedNodePools           []*NodePoolDocument      `json:"tolerated_node_pools"`
+	ToleratedNodes               []*NodeDocument          `json:"tolerated_nodes"`
+	BlockingNodePools            []*NodePoolDocument      `json:"blocking_node_pools"`
+	BlockingNodes                []*NodeDocument          `json:"blocking_nodes"`
+	LeftoverTaintedNodes         []*NodeDocument          `json:"leftover_tainted_nodes"`
+	CostEstimate                 *CostDocument            `json:"cost_estimate,omitempty"`
+	Trend                        *TrendDocument           `json:"trend,omitempty"`
+}
+
+//
+type ClusterDocument struct {
+	Name        string `json:"name"`
+	Region      string `json:"region"`
+	Status      string `json:"status"`
+	ResourceURL string `json:"resource_url"`
+}
+
+//
+type NodePoolDocument struct {
+	Name         string `json:"name"`
+	Preemptible  bool   `json:"preemptible"`
+	Autoscale    bool   `json:"autoscale"`
+	MinNodeCount int    `json:"min_node_count"`
+	MaxNodeCount int    `json:"max_node_count"`
+	Status       string `json:"status"`
+	ResourceURL  string `json:"resource_url"`
+}
+
+//
+type NodeDocument struct {
+	Name        string `json:"name"`
+	NodePool    string `json:"node_pool"`
+	Zone        string `json:"zone"`
+	Ready       bool   `json:"ready"`
+	Preemptible bool   `json:"preemptible"`
+	AgeSeconds  int64  `json:"age_seconds"`
+	PodCount    int    `json:"pod_count"`
+	ResourceURL string `json:"resource_url"`
+	// PreDrainTaint is the taint added by the optimizer before the drain.
+	PreDrainTaint string `json:"pre_drain_taint,omitempty"`
+}
+
+//
+type ConsolidationDocument struct {
+	Targets []*CandidateDocument `json:"targets"`
+	Skipped []*CandidateDocument `json:"skipped"`
+}
+
+//
+type CandidateDocument struct {
+	Node              *NodeDocument `json:"node"`
+	CPUUtilization    int           `json:"cpu_utilization"`
+	MemoryUtilization int           `json:"memory_utilization"`
+	// Destinations is the node names where the pods are placed in the simulation, by the pod name.
+	Destinations map[string]string `json:"destinations,omitempty"`
+	Reason       string            `json:"reason,omitempty"`
+}
+
+//
+type ProtectedNodeDocument struct {
+	Node   *NodeDocument `json:"node"`
+	Policy string        `json:"policy"`
+	// Pods is the namespaced names of the protected pods.
+	Pods []string `json:"pods"`
+}
+
+//
+type HookDocument struct {
+	Name            string  `json:"name"`
+	Phase           string  `json:"phase"`
+	Mode            string  `json:"mode"`
+	NodeName        string  `json:"node_name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Succeeded       bool    `json:"succeeded"`
+	Vetoed          bool    `json:"vetoed"`
+	Output          string  `json:"output,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+//
+type OperationDocument struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Status    string `json:"status"`
+	NodePool  string `json:"node_pool,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	StartTime string `json:"start_time,omitempty"`
+}
+
+//
+type CostDocument struct {
+	Currency                  string    `json:"currency"`
+	PeriodSeconds             int64     `json:"period_seconds"`
+	PreemptibleSavingsPerHour float64   `json:"preemptible_savings_per_hour"`
+	OndemandSavingsPerHour    float64   `json:"ondemand_savings_per_hour"`
+	Savings                   float64   `json:"savings"`
+	CumulativeSavings         float64   `json:"cumulative_savings"`
+	CumulativeRuns            int       `json:"cumulative_runs"`
+	CumulativeSince           time.Time `json:"cumulative_since"`
+	UnknownMachineTypes       []string  `json:"unknown_machine_types,omitempty"`
+}
+
+//
+type TrendDocument struct {
+	Runs                           int                         `json:"runs"`
+	SucceededRuns                  int                         `json:"succeeded_runs"`
+	SuccessRate                    float64                     `json:"success_rate"`
+	Since                          time.Time                   `json:"since"`
+	AverageRefreshedNodeAgeSeconds int64                       `json:"average_refreshed_node_age_seconds"`
+	OndemandNodeCountMin           int                         `json:"ondemand_node_count_min"`
+	OndemandNodeCountAvg           float64                     `json:"ondemand_node_count_avg"`
+	OndemandNodeCountMax           int                         `json:"ondemand_node_count_max"`
+	OndemandNodeCounts             []*TrendPointDocument       `json:"ondemand_node_counts"`
+	RecurringFailures              []*RecurringFailureDocument `json:"recurring_failures"`
+}
+
+//
+type TrendPointDocument struct {
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+}
+
+//
+type RecurringFailureDocument struct {
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+	LastTime time.Time `json:"last_time"`
+}
+
+//
+type PodDocument struct {
+	Name          string            `json:"name"`
+	Namespace     string            `json:"namespace"`
+	NodeName      string            `json:"node_name"`
+	OwnerKind     string            `json:"owner_kind,omitempty"`
+	OwnerName     string            `json:"owner_name,omitempty"`
+	PriorityClass string            `json:"priority_class,omitempty"`
+	Priority      int32             `json:"priority"`
+	QOSClass      string            `json:"qos_class,omitempty"`
+	Requests      *ResourceDocument `json:"requests"`
+	Limits        *ResourceDocument `json:"limits"`
+	Volumes       []*VolumeDocument `json:"volumes,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+//
+type ResourceDocument struct {
+	MilliCPU int64 `json:"milli_cpu"`
+	Memory   int64 `json:"memory"`
+}
+
+//
+type VolumeDocument struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	ClaimName string `json:"claim_name,omitempty"`
+}
+
+// WorkloadDocument is the evicted pods grouped by the controller.
+type WorkloadDocument struct {
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	NodeNames []string `json:"node_names"`
+	Pods      []string `json:"pods"`
+}
+
+//
+type EvictionDocument struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	NodeName  string `json:"node_name"`
+	Outcome   string `json:"outcome"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error,omitempty"`
+	// EscalatedFrom is the outcome before the pod is force deleted, such as blocked or stuck.
+	EscalatedFrom string `json:"escalated_from,omitempty"`
+}
+
+// Document returns the serializable form of the result.
+func (r *Result) Document() *Document {
+	doc := &Document{
+		Version:                      DocumentVersion,
+		ProjectID:                    r.projectID,
+		RunID:                        r.runID,
+		TraceID:                      r.TraceID,
+		Hostname:                     r.hostname,
+		StartTime:                    r.startTime,
+		EndTime:                      r.endTime,
+		Severity:                     r.Severity().String(),
+		Succeeded:                    r.Error == nil,
+		Aborted:                      r.Aborted,
+		DeferredReason:               r.DeferredReason,
+		RunningOperations:            make([]*OperationDocument, 0, len(r.RunningOperations)),
+		DetailLink:                   r.GetDetailLinks(),
+		PreemptibleNodeActualCount:   r.PreemptibleNodeActualCount,
+		PreemptibleNodeMinimumCount:  r.PreemptibleNodeMinimumCount,
+		TargetPreemptibleNode:        toNodeDocument(r.TargetPreemptibleNode),
+		TargetOndemandAutoscaleNode:  toNodeDocument(r.TargetOndemandAutoscaleNode),
+		TargetOndemandAutoscaleNodes: toNodeDocuments(r.GetTargetOndemandAutoscaleNodes()),
+		OndemandSkippedReason:        r.OndemandSkippedReason,
+		ProtectedNodes:               make([]*ProtectedNodeDocument, 0, len(r.ProtectedNodes)),
+		ReplacementNode:              toNodeDocument(r.ReplacementNode),
+		ReplacementFailure:           r.ReplacementFailure,
+		EvictedPods:                  make([]*PodDocument, 0, len(r.EvictedPods)),
+		EvictedWorkloads:             make([]*WorkloadDocument, 0, len(r.EvictedPods)),
+		Evictions:                    make([]*EvictionDocument, 0, len(r.Evictions)),
+		Hooks:                        make([]*HookDocument, 0, len(r.HookResults)),
+		ToleratedNodePools:           toNodePoolDocuments(r.ToleratedNodePools),
+		ToleratedNodes:               toNodeDocuments(r.ToleratedNodes),
+		BlockingNodePools:            toNodePoolDocuments(r.BlockingNodePools),
+		BlockingNodes:                toNodeDocuments(r.BlockingNodes),
+		LeftoverTaintedNodes:         toNodeDocuments(r.LeftoverTaintedNodes),
+	}
+	if r.Error != nil {
+		doc.Error = r.Error.Error()
+	}
+	if r.Cluster != nil {
+		doc.Cluster = &ClusterDocument{
+			Name:        r.Cluster.Name,
+			Region:      r.Cluster.Region,
+			Status:      r.Cluster.Status.String(),
+			ResourceURL: r.Cluster.ResourceURL,
+		}
+	}
+	for _, v := range r.RunningOperations {
+		doc.RunningOperations = append(doc.RunningOperations, &OperationDocument{
+			Name:      v.Name,
+			Type:      v.Type.String(),
+			Status:    v.Status.String(),
+			NodePool:  v.NodePool,
+			Detail:    v.Detail,
+			StartTime: v.StartTime,
+		})
+	}
+	if c := r.Consolidation; c != nil {
+		doc.Consolidation = &ConsolidationDocument{
+			Targets: toCandidateDocuments(c.Targets),
+			Skipped: toCandidateDocuments(c.Skipped),
+		}
+	}
+	for _, v := range r.ProtectedNodes {
+		p := &ProtectedNodeDocument{Node: toNodeDocument(v.Node), Policy: string(v.Policy), Pods: make([]string, 0, len(v.Pods))}
+		for _, pod := range v.Pods {
+			p.Pods = append(p.Pods, pod.Namespace+"/"+pod.Name)
+		}
+		doc.ProtectedNodes = append(doc.ProtectedNodes, p)
+	}
+	if c := r.CostEstimate; c != nil {
+		doc.CostEstimate = &CostDocument{
+			Currency:                  c.Currency,
+			PeriodSeconds:             int64(c.Period / time.Second),
+			PreemptibleSavingsPerHour: c.PreemptibleSavingsPerHour,
+			OndemandSavingsPerHour:    c.OndemandSavingsPerHour,
+			Savings:                   c.Savings,
+			CumulativeSavings:         c.CumulativeSavings,
+			CumulativeRuns:            c.CumulativeRuns,
+			CumulativeSince:           c.CumulativeSince,
+			UnknownMachineTypes:       c.UnknownMachineTypes,
+		}
+	}
+	if t := r.Trend; t != nil {
+		min, avg, max := t.OndemandNodeCountRange()
+		doc.Trend = &TrendDocument{
+			Runs:                           t.Runs,
+			SucceededRuns:                  t.SucceededRuns,
+			SuccessRate:                    t.SuccessRate(),
+			Since:                          t.Since,
+			AverageRefreshedNodeAgeSeconds: int64(t.AverageRefreshedNodeAge / time.Second),
+			OndemandNodeCountMin:           min,
+			OndemandNodeCountAvg:           avg,
+			OndemandNodeCountMax:           max,
+			OndemandNodeCounts:             make([]*TrendPointDocument, 0, len(t.OndemandNodeCounts)),
+			RecurringFailures:              make([]*RecurringFailureDocument, 0, len(t.RecurringFailures)),
+		}
+		for _, v := range t.OndemandNodeCounts {
+			doc.Trend.OndemandNodeCounts = append(doc.Trend.OndemandNodeCounts, &TrendPointDocument{Time: v.Time, Count: v.Count})
+		}
+		for _, v := range t.RecurringFailures {
+			doc.Trend.RecurringFailures = append(doc.Trend.RecurringFailures, &RecurringFailureDocument{Message: v.Message, Count: v.Count, LastTime: v.LastTime})
+		}
+	}
+	doc.ActiveNodePools = toNodePoolDocuments(r.ActiveNodePools)
+	doc.ActiveNodes = toNodeDocuments(r.ActiveNodes)
+	for _, v := range r.EvictedPods {
+		doc.EvictedPods = append(doc.EvictedPods, toPodDocument(v))
+	}
+	for _, v := range gke.GroupByWorkload(r.EvictedPods) {
+		w := &WorkloadDocument{Kind: v.Kind, Name: v.Name, Namespace: v.Namespace, NodeNames: make([]string, 0, 1), Pods: make([]string, 0, len(v.Pods))}
+		nodeNames := make(map[string]bool, 1)
+		for _, pod := range v.Pods {
+			w.Pods = append(w.Pods, pod.Name)
+			if !nodeNames[pod.NodeName] {
+				nodeNames[pod.NodeName] = true
+				w.NodeNames = append(w.NodeNames, pod.NodeName)
+			}
+		}
+		doc.EvictedWorkloads = append(doc.EvictedWorkloads, w)
+	}
+	for _, v := range r.Evictions {
+		e := &EvictionDocument{
+			Name:          v.Pod.Name,
+			Namespace:     v.Pod.Namespace,
+			NodeName:      v.Pod.NodeName,
+			Outcome:       string(v.Outcome),
+			Attempts:      v.Attempts,
+			EscalatedFrom: string(v.EscalatedFrom),
+		}
+		if v.Err != nil {
+			e.Error = v.Err.Error()
+		}
+		doc.Evictions = append(doc.Evictions, e)
+	}
+	for _, v := range r.HookResults {
+		h := &HookDocument{
+			Name:            v.Name,
+			Phase:           string(v.Phase),
+			Mode:            string(v.Mode),
+			NodeName:        v.NodeName,
+			DurationSeconds: v.Duration.Seconds(),
+			Succeeded:       v.Err == nil,
+			Vetoed:          v.Vetoed(),
+			Output:          v.Output,
+		}
+		if v.Err != nil {
+			h.Error = v.Err.Error()
+		}
+		doc.Hooks = append(doc.Hooks, h)
+	}
+	return doc
+}
+
+//
+func toNodePoolDocuments(in []*gke.NodePool) []*NodePoolDocument {
+	ret := make([]*NodePoolDocument, 0, len(in))
+	for _, v := range in {
+		ret = append(ret, &NodePoolDocument{
+			Name:         v.Name,
+			Preemptible:  v.Preemptible,
+			Autoscale:    v.Autoscale,
+			MinNodeCount: v.MinNodeCount,
+			MaxNodeCount: v.MaxNodeCount,
+			Status:       v.Status.String(),
+			ResourceURL:  v.ResourceURL,
+		})
+	}
+	return ret
+}
+
+//
+func toNodeDocuments(in []*gke.Node) []*NodeDocument {
+	ret := make([]*NodeDocument, 0, len(in))
+	for _, v := range in {
+		ret = append(ret, toNodeDocument(v))
+	}
+	return ret
+}
+
+//
+func toPodDocument(in *gke.Pod) *PodDocument {
+	ret := &PodDocument{
+		Name:          in.Name,
+		Namespace:     in.Namespace,
+		NodeName:      in.NodeName,
+		OwnerKind:     in.OwnerKind,
+		OwnerName:     in.OwnerName,
+		PriorityClass: in.PriorityClassName,
+		Priority:      in.Priority,
+		QOSClass:      string(in.QOSClass),
+		Requests:      &ResourceDocument{MilliCPU: in.Requests.MilliCPU, Memory: in.Requests.Memory},
+		Limits:        &ResourceDocument{MilliCPU: in.Limits.MilliCPU, Memory: in.Limits.Memory},
+		Annotations:   in.Annotations,
+	}
+	for _, v := range in.Volumes {
+		ret.Volumes = append(ret.Volumes, &VolumeDocument{Name: v.Name, Kind: v.Kind, ClaimName: v.ClaimName})
+	}
+	return ret
+}
+
+//
+func toCandidateDocuments(in []*consolidation.Candidate) []*CandidateDocument {
+	ret := make([]*CandidateDocument, 0, len(in))
+	for _, v := range in {
+		ret = append(ret, &CandidateDocument{
+			Node:              toNodeDocument(v.Node),
+			CPUUtilization:    v.CPUUtilization,
+			MemoryUtilization: v.MemoryUtilization,
+			Destinations:      v.Destinations,
+			Reason:            v.Reason,
+		})
+	}
+	return ret
+}
+
+//
+func toNodeDocument(in *gke.Node) *NodeDocument {
+	if in == nil {
+		return nil
+	}
+	return &NodeDocument{
+		Name:          in.Name,
+		NodePool:      in.NodePool,
+		Zone:          in.Zone,
+		Ready:         in.Ready,
+		Preemptible:   in.Preemptible,
+		AgeSeconds:    int64(in.Age / time.Second),
+		PodCount:      len(in.Pods),
+		PreDrainTaint: in.PreDrainTaint,
+		ResourceURL:   in.ResourceURL,
+	}
+}
@@ -0,0 +1,468 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"os"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/na-ga/gke-node-optimizer/gke"
+)
+
+//
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+// StdoutPath is the output path which means the standard output.
+const StdoutPath = "-"
+
+//
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatJSON, FormatMarkdown, FormatHTML:
+		return f, nil
+	case "md":
+		return FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("unknown format: %s", s)
+}
+
+//
+type fileReporter struct {
+	format Format
+	path   string
+}
+
+// NewFileReporter returns the reporter that writes the document of the result to the path.
+// The document is written to the standard output if the path is empty or "-".
+func NewFileReporter(format Format, path string) Reporter {
+	if path == "" {
+		path = StdoutPath
+	}
+	return &fileReporter{
+		format: format,
+		path:   path,
+	}
+}
+
+//
+func (f *fileReporter) Report(result *Result) error {
+	if f.path == StdoutPath {
+		return Render(os.Stdout, f.format, result)
+	}
+	file, err := os.Create(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %s", f.path, err)
+	}
+	if err := Render(file, f.format, result); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to render %s to file %s: %s", f.format, f.path, err)
+	}
+	return file.Close()
+}
+
+// Render writes the document of the result in the format.
+func Render(w io.Writer, format Format, result *Result) error {
+	doc := result.Finish().Document()
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(doc)
+	case FormatMarkdown:
+		return markdownTemplate.Execute(w, doc)
+	case FormatHTML:
+		return htmlReportTemplate.Execute(w, doc)
+	}
+	return fmt.Errorf("unknown format: %s", format)
+}
+
+//
+var templateFuncs = map[string]interface{}{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "unknown"
+		}
+		return t.In(timeZone).Format(time.RFC3339)
+	},
+	"age": func(seconds int64) string {
+		return shortDurationString(time.Duration(seconds) * time.Second)
+	},
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"join": func(values []string) string {
+		return strings.Join(values, ", ")
+	},
+	"money": func(amount float64) string {
+		return fmt.Sprintf("%.2f", amount)
+	},
+	"percent": func(ratio float64) string {
+		return fmt.Sprintf("%.1f%%", ratio*100)
+	},
+	"unevicted": func(evictions []*EvictionDocument) []*EvictionDocument {
+		ret := make([]*EvictionDocument, 0, len(evictions))
+		for _, v := range evictions {
+			if v.Outcome != string(gke.EvictionOutcomeEvicted) && v.Outcome != string(gke.EvictionOutcomeRestarted) {
+				ret = append(ret, v)
+			}
+		}
+		return ret
+	},
+}
+
+//
+var markdownTemplate = textTemplate.Must(textTemplate.New("markdown").Funcs(templateFuncs).Parse(`# GKE node optimizer report
+
+| Item | Value |
+| --- | --- |
+| Version | {{ .Version }} |
+| Project | {{ .ProjectID }} |
+| Run ID | {{ .RunID }} |
+{{- with .TraceID }}
+| Trace ID | {{ . }} |
+{{- end }}
+| Cluster | {{ with .Cluster }}[{{ .Name }}]({{ .ResourceURL }}){{ else }}unknown{{ end }} |
+| Severity | {{ .Severity }} |
+| Succeeded | {{ .Succeeded }} |
+{{- if .Aborted }}
+| Aborted | true |
+{{- end }}
+| Start time | {{ time .StartTime }} |
+| End time | {{ time .EndTime }} |
+| Cluster nodes count | {{ len .ActiveNodes }} |
+| Preemptible nodes count | {{ .PreemptibleNodeActualCount }} |
+| Preemptible nodes minimum count | {{ .PreemptibleNodeMinimumCount }} |
+{{- with .CostEstimate }}
+| Estimated savings | {{ money .Savings }} {{ .Currency }} per {{ age .PeriodSeconds }} |
+| Cumulative estimated savings | {{ money .CumulativeSavings }} {{ .Currency }} in {{ .CumulativeRuns }} runs since {{ time .CumulativeSince }} |
+{{- end }}
+{{- with .DetailLink }}
+| Detail | [logs]({{ . }}) |
+{{- end }}
+{{ with .Error }}
+## Error
+
+` + "```" + `
+{{ . }}
+` + "```" + `
+{{ end }}
+{{- with .DeferredReason }}
+## Deferred
+
+` + "```" + `
+{{ . }}
+` + "```" + `
+{{ end }}
+{{- if .RunningOperations }}
+## Running operations
+
+| # | Name | Type | Status | Node pool | Start time |
+| --- | --- | --- | --- | --- | --- |
+{{- range $i, $v := .RunningOperations }}
+| {{ inc $i }} | {{ $v.Name }} | {{ $v.Type }} | {{ $v.Status }} | {{ $v.NodePool }} | {{ $v.StartTime }} |
+{{- end }}
+{{ end }}
+{{- with .Trend }}
+## Trends
+
+| Item | Value |
+| --- | --- |
+| Runs | {{ .Runs }} since {{ time .Since }} |
+| Success rate | {{ percent .SuccessRate }} |
+| Average node age at refresh | {{ age .AverageRefreshedNodeAgeSeconds }} |
+| On-demand nodes count | min={{ .OndemandNodeCountMin }}, avg={{ printf "%.1f" .OndemandNodeCountAvg }}, max={{ .OndemandNodeCountMax }} |
+{{- if .RecurringFailures }}
+
+| # | Recurring failure | Count | Last time |
+| --- | --- | --- | --- |
+{{- range $i, $v := .RecurringFailures }}
+| {{ inc $i }} | {{ $v.Message }} | {{ $v.Count }} | {{ time $v.LastTime }} |
+{{- end }}
+{{- end }}
+{{ end }}
+## Active node pools
+
+| # | Name | Preemptible | Autoscale | Min | Max | Status |
+| --- | --- | --- | --- | --- | --- | --- |
+{{- range $i, $v := .ActiveNodePools }}
+| {{ inc $i }} | [{{ $v.Name }}]({{ $v.ResourceURL }}) | {{ $v.Preemptible }} | {{ $v.Autoscale }} | {{ $v.MinNodeCount }} | {{ $v.MaxNodeCount }} | {{ $v.Status }} |
+{{- end }}
+
+## Active nodes
+
+| # | Name | Node pool | Zone | Age | Pods |
+| --- | --- | --- | --- | --- | --- |
+{{- range $i, $v := .ActiveNodes }}
+| {{ inc $i }} | {{ $v.Name }} | {{ $v.NodePool }} | {{ $v.Zone }} | {{ age $v.AgeSeconds }} | {{ $v.PodCount }} |
+{{- end }}
+
+{{ if or .ToleratedNodePools .ToleratedNodes .BlockingNodePools .BlockingNodes .LeftoverTaintedNodes -}}
+## Unhealthy members
+
+| Name | Kind | Status | Gate |
+| --- | --- | --- | --- |
+{{- range .BlockingNodePools }}
+| {{ .Name }} | node pool | {{ .Status }} | blocking |
+{{- end }}
+{{- range .BlockingNodes }}
+| {{ .Name }} | node | not ready | blocking |
+{{- end }}
+{{- range .ToleratedNodePools }}
+| {{ .Name }} | node pool | {{ .Status }} | tolerated |
+{{- end }}
+{{- range .ToleratedNodes }}
+| {{ .Name }} | node | not ready | tolerated |
+{{- end }}
+{{- range .LeftoverTaintedNodes }}
+| {{ .Name }} | node | tainted {{ .PreDrainTaint }} | leftover |
+{{- end }}
+
+{{ end -}}
+## Refresh targets
+
+{{ with .TargetPreemptibleNode }}- Preemptible node: {{ .Name }} (age={{ age .AgeSeconds }}, pods={{ .PodCount }})
+{{ end -}}
+{{ with .ReplacementNode }}- Replacement node: {{ .Name }} (pool={{ .NodePool }}, zone={{ .Zone }})
+{{ end -}}
+{{ with .ReplacementFailure }}- Replacement failure: {{ . }}
+{{ end -}}
+{{ range .TargetOndemandAutoscaleNodes }}- Ondemand auto scale node: {{ .Name }} (age={{ age .AgeSeconds }}, pods={{ .PodCount }})
+{{ end -}}
+{{ with .OndemandSkippedReason }}- Ondemand drain skipped: {{ . }}
+{{ end -}}
+{{ if not (or .TargetPreemptibleNode .TargetOndemandAutoscaleNodes) }}- none
+{{ end }}
+{{ with .Consolidation -}}
+## Consolidation
+
+| Node | CPU | Memory | Result |
+| --- | --- | --- | --- |
+{{- range .Targets }}
+| {{ .Node.Name }} | {{ .CPUUtilization }}% | {{ .MemoryUtilization }}% | drain |
+{{- end }}
+{{- range .Skipped }}
+| {{ .Node.Name }} | {{ .CPUUtilization }}% | {{ .MemoryUtilization }}% | skip: {{ .Reason }} |
+{{- end }}
+
+{{ end -}}
+{{ if .ProtectedNodes -}}
+## Protected nodes
+
+| Node | Policy | Pods |
+| --- | --- | --- |
+{{- range .ProtectedNodes }}
+| {{ .Node.Name }} | {{ .Policy }} | {{ join .Pods }} |
+{{- end }}
+
+{{ end -}}
+{{ if .Hooks -}}
+## Drain hooks
+
+| Name | Phase | Mode | Node | Result | Error |
+| --- | --- | --- | --- | --- | --- |
+{{- range .Hooks }}
+| {{ .Name }} | {{ .Phase }} | {{ .Mode }} | {{ .NodeName }} | {{ if .Vetoed }}vetoed{{ else if .Succeeded }}succeeded{{ else }}failed{{ end }} | {{ .Error }} |
+{{- end }}
+
+{{ end -}}
+## Evicted pods
+
+| # | Workload | Namespace | Nodes | Pods |
+| --- | --- | --- | --- | --- |
+{{- range $i, $v := .EvictedWorkloads }}
+| {{ inc $i }} | {{ $v.Kind }}/{{ $v.Name }} | {{ $v.Namespace }} | {{ join $v.NodeNames }} | {{ len $v.Pods }} |
+{{- end }}
+{{- if unevicted .Evictions }}
+
+## Unevicted pods
+
+| Name | Namespace | Node | Outcome | Attempts | Error |
+| --- | --- | --- | --- | --- | --- |
+{{- range unevicted .Evictions }}
+| {{ .Name }} | {{ .Namespace }} | {{ .NodeName }} | {{ .Outcome }}{{ with .EscalatedFrom }} ({{ . }}){{ end }} | {{ .Attempts }} | {{ .Error }} |
+{{- end }}
+{{- end }}
+`))
+
+//
+var htmlReportTemplate = htmlTemplate.Must(htmlTemplate.New("html").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GKE node optimizer report</title>
+</head>
+<body>
+<h1>GKE node optimizer report</h1>
+<table>
+<tr><th>Version</th><td>{{ .Version }}</td></tr>
+<tr><th>Project</th><td>{{ .ProjectID }}</td></tr>
+<tr><th>Run ID</th><td>{{ .RunID }}</td></tr>
+{{- with .TraceID }}
+<tr><th>Trace ID</th><td>{{ . }}</td></tr>
+{{- end }}
+<tr><th>Cluster</th><td>{{ with .Cluster }}<a href="{{ .ResourceURL }}">{{ .Name }}</a>{{ else }}unknown{{ end }}</td></tr>
+<tr><th>Severity</th><td>{{ .Severity }}</td></tr>
+<tr><th>Succeeded</th><td>{{ .Succeeded }}</td></tr>
+{{- if .Aborted }}
+<tr><th>Aborted</th><td>true</td></tr>
+{{- end }}
+<tr><th>Start time</th><td>{{ time .StartTime }}</td></tr>
+<tr><th>End time</th><td>{{ time .EndTime }}</td></tr>
+<tr><th>Cluster nodes count</th><td>{{ len .ActiveNodes }}</td></tr>
+<tr><th>Preemptible nodes count</th><td>{{ .PreemptibleNodeActualCount }}</td></tr>
+<tr><th>Preemptible nodes minimum count</th><td>{{ .PreemptibleNodeMinimumCount }}</td></tr>
+{{- with .CostEstimate }}
+<tr><th>Estimated savings</th><td>{{ money .Savings }} {{ .Currency }} per {{ age .PeriodSeconds }}</td></tr>
+<tr><th>Cumulative estimated savings</th><td>{{ money .CumulativeSavings }} {{ .Currency }} in {{ .CumulativeRuns }} runs since {{ time .CumulativeSince }}</td></tr>
+{{- end }}
+{{- with .DetailLink }}
+<tr><th>Detail</th><td><a href="{{ . }}">logs</a></td></tr>
+{{- end }}
+</table>
+{{- with .Error }}
+<h2>Error</h2>
+<pre>{{ . }}</pre>
+{{- end }}
+{{- with .DeferredReason }}
+<h2>Deferred</h2>
+<pre>{{ . }}</pre>
+{{- end }}
+{{- if .RunningOperations }}
+<h2>Running operations</h2>
+<table>
+<tr><th>#</th><th>Name</th><th>Type</th><th>Status</th><th>Node pool</th><th>Start time</th></tr>
+{{- range $i, $v := .RunningOperations }}
+<tr><td>{{ inc $i }}</td><td>{{ $v.Name }}</td><td>{{ $v.Type }}</td><td>{{ $v.Status }}</td><td>{{ $v.NodePool }}</td><td>{{ $v.StartTime }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- with .Trend }}
+<h2>Trends</h2>
+<table>
+<tr><th>Runs</th><td>{{ .Runs }} since {{ time .Since }}</td></tr>
+<tr><th>Success rate</th><td>{{ percent .SuccessRate }}</td></tr>
+<tr><th>Average node age at refresh</th><td>{{ age .AverageRefreshedNodeAgeSeconds }}</td></tr>
+<tr><th>On-demand nodes count</th><td>min={{ .OndemandNodeCountMin }}, avg={{ printf "%.1f" .OndemandNodeCountAvg }}, max={{ .OndemandNodeCountMax }}</td></tr>
+</table>
+{{- if .RecurringFailures }}
+<table>
+<tr><th>#</th><th>Recurring failure</th><th>Count</th><th>Last time</th></tr>
+{{- range $i, $v := .RecurringFailures }}
+<tr><td>{{ inc $i }}</td><td>{{ $v.Message }}</td><td>{{ $v.Count }}</td><td>{{ time $v.LastTime }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+<h2>Active node pools</h2>
+<table>
+<tr><th>#</th><th>Name</th><th>Preemptible</th><th>Autoscale</th><th>Min</th><th>Max</th><th>Status</th></tr>
+{{- range $i, $v := .ActiveNodePools }}
+<tr><td>{{ inc $i }}</td><td><a href="{{ $v.ResourceURL }}">{{ $v.Name }}</a></td><td>{{ $v.Preemptible }}</td><td>{{ $v.Autoscale }}</td><td>{{ $v.MinNodeCount }}</td><td>{{ $v.MaxNodeCount }}</td><td>{{ $v.Status }}</td></tr>
+{{- end }}
+</table>
+<h2>Active nodes</h2>
+<table>
+<tr><th>#</th><th>Name</th><th>Node pool</th><th>Zone</th><th>Age</th><th>Pods</th></tr>
+{{- range $i, $v := .ActiveNodes }}
+<tr><td>{{ inc $i }}</td><td>{{ $v.Name }}</td><td>{{ $v.NodePool }}</td><td>{{ $v.Zone }}</td><td>{{ age $v.AgeSeconds }}</td><td>{{ $v.PodCount }}</td></tr>
+{{- end }}
+</table>
+{{- if or .ToleratedNodePools .ToleratedNodes .BlockingNodePools .BlockingNodes .LeftoverTaintedNodes }}
+<h2>Unhealthy members</h2>
+<table>
+<tr><th>Name</th><th>Kind</th><th>Status</th><th>Gate</th></tr>
+{{- range .BlockingNodePools }}
+<tr><td>{{ .Name }}</td><td>node pool</td><td>{{ .Status }}</td><td>blocking</td></tr>
+{{- end }}
+{{- range .BlockingNodes }}
+<tr><td>{{ .Name }}</td><td>node</td><td>not ready</td><td>blocking</td></tr>
+{{- end }}
+{{- range .ToleratedNodePools }}
+<tr><td>{{ .Name }}</td><td>node pool</td><td>{{ .Status }}</td><td>tolerated</td></tr>
+{{- end }}
+{{- range .ToleratedNodes }}
+<tr><td>{{ .Name }}</td><td>node</td><td>not ready</td><td>tolerated</td></tr>
+{{- end }}
+{{- range .LeftoverTaintedNodes }}
+<tr><td>{{ .Name }}</td><td>node</td><td>tainted {{ .PreDrainTaint }}</td><td>leftover</td></tr>
+{{- end }}
+</table>
+{{- end }}
+<h2>Refresh targets</h2>
+<ul>
+{{- with .TargetPreemptibleNode }}
+<li>Preemptible node: {{ .Name }} (age={{ age .AgeSeconds }}, pods={{ .PodCount }})</li>
+{{- end }}
+{{- with .ReplacementNode }}
+<li>Replacement node: {{ .Name }} (pool={{ .NodePool }}, zone={{ .Zone }})</li>
+{{- end }}
+{{- with .ReplacementFailure }}
+<li>Replacement failure: {{ . }}</li>
+{{- end }}
+{{- range .TargetOndemandAutoscaleNodes }}
+<li>Ondemand auto scale node: {{ .Name }} (age={{ age .AgeSeconds }}, pods={{ .PodCount }})</li>
+{{- end }}
+{{- with .OndemandSkippedReason }}
+<li>Ondemand drain skipped: {{ . }}</li>
+{{- end }}
+</ul>
+{{- with .Consolidation }}
+<h2>Consolidation</h2>
+<table>
+<tr><th>Node</th><th>CPU</th><th>Memory</th><th>Result</th></tr>
+{{- range .Targets }}
+<tr><td>{{ .Node.Name }}</td><td>{{ .CPUUtilization }}%</td><td>{{ .MemoryUtilization }}%</td><td>drain</td></tr>
+{{- end }}
+{{- range .Skipped }}
+<tr><td>{{ .Node.Name }}</td><td>{{ .CPUUtilization }}%</td><td>{{ .MemoryUtilization }}%</td><td>skip: {{ .Reason }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .ProtectedNodes }}
+<h2>Protected nodes</h2>
+<table>
+<tr><th>Node</th><th>Policy</th><th>Pods</th></tr>
+{{- range .ProtectedNodes }}
+<tr><td>{{ .Node.Name }}</td><td>{{ .Policy }}</td><td>{{ join .Pods }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Hooks }}
+<h2>Drain hooks</h2>
+<table>
+<tr><th>Name</th><th>Phase</th><th>Mode</th><th>Node</th><th>Result</th><th>Error</th></tr>
+{{- range .Hooks }}
+<tr><td>{{ .Name }}</td><td>{{ .Phase }}</td><td>{{ .Mode }}</td><td>{{ .NodeName }}</td><td>{{ if .Vetoed }}vetoed{{ else if .Succeeded }}succeeded{{ else }}failed{{ end }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+<h2>Evicted pods</h2>
+<table>
+<tr><th>#</th><th>Workload</th><th>Namespace</th><th>Nodes</th><th>Pods</th></tr>
+{{- range $i, $v := .EvictedWorkloads }}
+<tr><td>{{ inc $i }}</td><td>{{ $v.Kind }}/{{ $v.Name }}</td><td>{{ $v.Namespace }}</td><td>{{ join $v.NodeNames }}</td><td>{{ len $v.Pods }}</td></tr>
+{{- end }}
+</table>
+{{- if unevicted .Evictions }}
+<h2>Unevicted pods</h2>
+<table>
+<tr><th>Name</th><th>Namespace</th><th>Node</th><th>Outcome</th><th>Attempts</th><th>Error</th></tr>
+{{- range unevicted .Evictions }}
+<tr><td>{{ .Name }}</td><td>{{ .Namespace }}</td><td>{{ .NodeName }}</td><td>{{ .Outcome }}{{ with .EscalatedFrom }} ({{ . }}){{ end }}</td><td>{{ .Attempts }}</td><td>{{ .Error }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,40 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+)
+
+func TestFileReporterStdoutHoldsOnlyDocument(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	log.Info("Log written before the report")
+	err = NewFileReporter(FormatJSON, StdoutPath).Report(NewResult("project", "run"))
+	log.Info("Log written after the report")
+	os.Stdout = stdout
+	_ = w.Close()
+	if err != nil {
+		t.Fatalf("failed to report: %s", err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("stdout holds other than the document: %s: %s", err, b)
+	}
+	if doc.RunID != "run" {
+		t.Errorf("unexpected run id of the document: %s", doc.RunID)
+	}
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/na-ga/gke-node-optimizer/log"
+)
+
+//
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+//
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "info", "all":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "error", "failure":
+		return SeverityError, nil
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity: %s", s)
+}
+
+//
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// Sink is a reporter with the routing rule.
+type Sink struct {
+	// Name is used to identify the sink in the log output.
+	Name string
+	// Reporter is the destination of the result.
+	Reporter Reporter
+	// MinSeverity is the minimum severity of the result to be reported.
+	MinSeverity Severity
+}
+
+//
+type multiReporter struct {
+	sinks []Sink
+}
+
+// NewMultiReporter returns the reporter that reports to multiple sinks concurrently.
+func NewMultiReporter(sinks ...Sink) Reporter {
+	return &multiReporter{sinks: sinks}
+}
+
+//
+func (m *multiReporter) Report(result *Result) error {
+	severity := result.Finish().Severity() // capture the end time before sinks run concurrently
+	errs := make([]error, len(m.sinks))
+	wg := sync.WaitGroup{}
+	for i, sink := range m.sinks {
+		if severity < sink.MinSeverity {
+			log.Debugf("Skip report because severity is lower than minimum: sink=%s, severity=%s, minimum=%s", sink.Name, severity, sink.MinSeverity)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("panic: %v", r) // isolate a panic of the sink
+				}
+			}()
+			errs[i] = sink.Reporter.Report(result)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	//
+	failed := make([]string, 0, len(m.sinks))
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		log.Errorf("Failed to report to sink %s: %s", m.sinks[i].Name, err)
+		failed = append(failed, fmt.Sprintf("%s: %s", m.sinks[i].Name, err))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to report to %d/%d sinks: %s", len(failed), len(m.sinks), strings.Join(failed, ", "))
+	}
+	return nil
+}
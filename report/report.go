@@ -6,7 +6,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/na-ga/gke-node-optimizer/consolidation"
+	"github.com/na-ga/gke-node-optimizer/cost"
 	"github.com/na-ga/gke-node-optimizer/gke"
+	"github.com/na-ga/gke-node-optimizer/hook"
+	"github.com/na-ga/gke-node-optimizer/log"
 )
 
 const (
@@ -40,12 +44,53 @@ func (r *reporter) Report(result *Result) error {
 	return nil
 }
 
+//
+type logReporter struct {
+}
+
+// NewLogReporter returns the reporter that writes the summary of the result to the log.
+func NewLogReporter() Reporter {
+	return &logReporter{}
+}
+
+//
+func (r *logReporter) Report(result *Result) error {
+	clusterName := "unknown"
+	if result.Cluster != nil {
+		clusterName = result.Cluster.Name
+	}
+	message := "All tasks has been completed"
+	if result.Aborted {
+		message = "Aborted: " + result.Error.Error()
+	} else if result.Error != nil {
+		message = result.Error.Error()
+	} else if result.DeferredReason != "" {
+		message = "Deferred: " + result.DeferredReason
+	} else if result.ReplacementFailure != "" {
+		message = "Capacity did not recover: " + result.ReplacementFailure
+	}
+	summary := fmt.Sprintf("Report gke node optimizer: severity=%s, cluster=%s, nodes=%d, preemptibleNodes=%d/%d, evictedPods=%d, message=%s",
+		result.Severity(), clusterName, len(result.ActiveNodes), result.PreemptibleNodeActualCount, result.PreemptibleNodeMinimumCount, len(result.EvictedPods), message)
+	switch result.Severity() {
+	case SeverityError:
+		log.Error(summary)
+	case SeverityWarning:
+		log.Warn(summary)
+	default:
+		log.Info(summary)
+	}
+	return nil
+}
+
 //
 type Result struct {
 	projectID                   string
+	runID                       string
 	hostname                    string
 	startTime                   time.Time
+	endTime                     time.Time
 	Error                       error
+	TraceID                     string
 	Cluster                     *gke.Cluster
 	PreemptibleNodeActualCount  int
 	PreemptibleNodeMinimumCount int
@@ -53,14 +98,39 @@ type Result struct {
 	ActiveNodes                 []*gke.Node
 	TargetPreemptibleNode       *gke.Node
 	TargetOndemandAutoscaleNode *gke.Node
+	Consolidation               *consolidation.Plan
+	OndemandSkippedReason       string
+	ProtectedNodes              []*ProtectedNode
 	EvictedPods                 []*gke.Pod
+	Evictions                   []*gke.Eviction
+	HookResults                 []*hook.Result
+	ToleratedNodePools          []*gke.NodePool
+	ToleratedNodes              []*gke.Node
+	BlockingNodePools           []*gke.NodePool
+	BlockingNodes               []*gke.Node
+	LeftoverTaintedNodes        []*gke.Node
+	DeferredReason              string
+	RunningOperations           []*gke.Operation
+	ReplacementNode             *gke.Node
+	ReplacementFailure          string
+	CostEstimate                *cost.Estimate
+	Trend                       *Trend
+	Aborted                     bool
+}
+
+// ProtectedNode is the node running the pods protected by the disruption policy, which is skipped or penalized in the selection.
+type ProtectedNode struct {
+	Node   *gke.Node
+	Policy gke.DisruptionPolicy
+	Pods   []*gke.Pod
 }
 
 //
-func NewResult(projectID string) *Result {
+func NewResult(projectID, runID string) *Result {
 	hostname, _ := os.Hostname()
 	return &Result{
 		projectID: projectID,
+		runID:     runID,
 		hostname:  hostname,
 		startTime: time.Now(),
 	}
@@ -72,6 +142,70 @@ func (r *Result) SetError(err error) *Result {
 	return r
 }
 
+// Finish captures the end time once, and returns the result.
+func (r *Result) Finish() *Result {
+	if r.endTime.IsZero() {
+		r.endTime = time.Now()
+	}
+	return r
+}
+
+//
+func (r *Result) ProjectID() string {
+	return r.projectID
+}
+
+//
+func (r *Result) RunID() string {
+	return r.runID
+}
+
+//
+func (r *Result) Hostname() string {
+	return r.hostname
+}
+
+//
+func (r *Result) StartTime() time.Time {
+	return r.startTime
+}
+
+// EndTime returns the end time, or the zero time if not finished.
+func (r *Result) EndTime() time.Time {
+	return r.endTime
+}
+
+// Severity returns the severity of the result used to route reports.
+func (r *Result) Severity() Severity {
+	if r.Error != nil {
+		return SeverityError
+	}
+	if r.DeferredReason != "" {
+		return SeverityWarning // does nothing
+	}
+	if r.ReplacementFailure != "" {
+		return SeverityWarning // capacity did not recover
+	}
+	if len(r.GetTargetOndemandAutoscaleNodes()) > 0 {
+		return SeverityWarning // uses autoscale nodes
+	}
+	if r.OndemandSkippedReason != "" {
+		return SeverityWarning // preemptible capacity is insufficient
+	}
+	if len(r.ToleratedNodePools) > 0 || len(r.ToleratedNodes) > 0 {
+		return SeverityWarning // ignores unhealthy members
+	}
+	if len(r.LeftoverTaintedNodes) > 0 {
+		return SeverityWarning // left by the aborted run
+	}
+	for _, v := range r.HookResults {
+		if v.Err != nil {
+			return SeverityWarning // advisory hooks failed
+		}
+	}
+	return SeverityInfo
+}
+
 //
 func (r *Result) GetDetailLinks() string {
 	if !strings.HasPrefix(r.hostname, "gke-node-optimizer-") {
@@ -80,12 +214,27 @@ func (r *Result) GetDetailLinks() string {
 	if r.Cluster == nil {
 		return ""
 	}
+	runIDQuery := ""
+	if r.runID != "" {
+		runIDQuery = "jsonPayload.run_id%3D%22" + r.runID + "%22%0A"
+	}
 	return "https://console.cloud.google.com/logs/query;query=resource.type%3D%22k8s_container%22%0A" +
 		"resource.labels.cluster_name%3D%22" + r.Cluster.Name + "%22%0A" +
-		"resource.labels.pod_name%3D%22" + r.hostname + "%22%0A" +
+		"resource.labels.pod_name%3D%22" + r.hostname + "%22%0A" + runIDQuery +
 		"timestamp%3E%3D%22" + r.startTime.Format(time.RFC3339) + "%22;summaryFields=:true:32:beginning?project=" + r.projectID
 }
 
+// GetTargetOndemandAutoscaleNodes returns the on-demand nodes targeted by the run, which are more than one by the consolidation.
+func (r *Result) GetTargetOndemandAutoscaleNodes() []*gke.Node {
+	if r.Consolidation != nil {
+		return r.Consolidation.TargetNodes()
+	}
+	if r.TargetOndemandAutoscaleNode != nil {
+		return []*gke.Node{r.TargetOndemandAutoscaleNode}
+	}
+	return nil
+}
+
 //
 func (r *Result) GetEvictedPodsByNodeName(nodeName string) []*gke.Pod {
 	ret := make([]*gke.Pod, 0, len(r.EvictedPods))
@@ -97,6 +246,17 @@ func (r *Result) GetEvictedPodsByNodeName(nodeName string) []*gke.Pod {
 	return ret
 }
 
+// GetUnevictedPods returns the evictions whose outcome is not evicted nor restarted, such as blocked by the disruption budget.
+func (r *Result) GetUnevictedPods() []*gke.Eviction {
+	ret := make([]*gke.Eviction, 0, len(r.Evictions))
+	for _, v := range r.Evictions {
+		if v.Outcome != gke.EvictionOutcomeEvicted && v.Outcome != gke.EvictionOutcomeRestarted {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
 // example: returns "03h" when input is "3h23m16.371753687s"
 func shortDurationString(duration time.Duration) string {
 	if d := duration / (time.Hour * 24); d > 0 {
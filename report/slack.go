@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/na-ga/gke-node-optimizer/gke"
+
 	"github.com/slack-go/slack"
 )
 
@@ -32,14 +34,32 @@ func (s *slackReporter) Report(result *Result) error {
 	color := ColorCodeGreen
 	title := "Succeeded in optimize gke cluster nodes."
 	message := "All tasks has been completed"
-	if result.Error != nil {
+	switch result.Severity() {
+	case SeverityError:
 		color = ColorCodeRed
 		title = "Failed to optimize gke cluster nodes."
 		message = result.Error.Error()
-	} else if result.TargetOndemandAutoscaleNode != nil {
+		if result.Aborted {
+			title = "Aborted to optimize gke cluster nodes."
+			message = fmt.Sprintf("Aborted by the signal, and cordoned nodes have been rolled back if possible: %s", result.Error)
+		}
+	case SeverityWarning:
 		color = ColorCodeOrange
 		title = "Succeeded in optimize gke cluster nodes, but there are some things to check."
 		message = "All tasks has been completed. However uses autoscale nodes. Check the capacity is sufficient."
+		if len(result.GetTargetOndemandAutoscaleNodes()) == 0 {
+			message = "All tasks has been completed. However ignores unhealthy node pools or nodes. Check the cluster health."
+		}
+		if result.OndemandSkippedReason != "" {
+			message = fmt.Sprintf("All tasks has been completed. However the on-demand node was not drained. Check the capacity of preemptible node pools: %s", result.OndemandSkippedReason)
+		}
+		if result.ReplacementFailure != "" {
+			message = fmt.Sprintf("All tasks has been completed. However the refreshed preemptible node was not replaced. Check the capacity is sufficient: %s", result.ReplacementFailure)
+		}
+		if result.DeferredReason != "" {
+			title = "Deferred optimize gke cluster nodes."
+			message = fmt.Sprintf("Nothing has been done because gke is changing the cluster. Retry after the change is completed: %s", result.DeferredReason)
+		}
 	}
 	if detail := result.GetDetailLinks(); detail != "" {
 		title += " " + s.WrapTextInLink("More detail information.", detail)
@@ -65,26 +85,77 @@ func (s *slackReporter) Report(result *Result) error {
 			activeNodeNameLinks[i] = fmt.Sprintf("- %02d: %s %s", i+1, v.Name, extra)
 		}
 	}
+	unhealthyMembers := make([]string, 0, len(result.BlockingNodePools)+len(result.BlockingNodes)+len(result.ToleratedNodePools)+len(result.ToleratedNodes)+len(result.LeftoverTaintedNodes))
+	for _, v := range result.BlockingNodePools {
+		unhealthyMembers = append(unhealthyMembers, fmt.Sprintf("- %02d: pool %s (status=%s, blocking)", len(unhealthyMembers)+1, v.Name, v.Status))
+	}
+	for _, v := range result.BlockingNodes {
+		unhealthyMembers = append(unhealthyMembers, fmt.Sprintf("- %02d: node %s (not ready, blocking)", len(unhealthyMembers)+1, v.Name))
+	}
+	for _, v := range result.ToleratedNodePools {
+		unhealthyMembers = append(unhealthyMembers, fmt.Sprintf("- %02d: pool %s (status=%s, tolerated)", len(unhealthyMembers)+1, v.Name, v.Status))
+	}
+	for _, v := range result.ToleratedNodes {
+		unhealthyMembers = append(unhealthyMembers, fmt.Sprintf("- %02d: node %s (not ready, tolerated)", len(unhealthyMembers)+1, v.Name))
+	}
+	for _, v := range result.LeftoverTaintedNodes {
+		unhealthyMembers = append(unhealthyMembers, fmt.Sprintf("- %02d: node %s (tainted %s, leftover)", len(unhealthyMembers)+1, v.Name, v.PreDrainTaint))
+	}
+	var recurringFailures []string
+	if result.Trend != nil {
+		for i, v := range result.Trend.RecurringFailures {
+			recurringFailures = append(recurringFailures, fmt.Sprintf("- %02d: %s (count=%d)", i+1, shortText(v.Message, 60), v.Count))
+		}
+	}
+	var unevictedPods []string
+	for i, v := range result.GetUnevictedPods() {
+		outcome := string(v.Outcome)
+		if v.EscalatedFrom != "" {
+			outcome = fmt.Sprintf("%s after %s", v.Outcome, v.EscalatedFrom)
+		}
+		unevictedPods = append(unevictedPods, fmt.Sprintf("- %02d: %s (ns=%s, outcome=%s, count=%d)", i+1, shortText(v.Pod.Name, 40), v.Pod.Namespace, outcome, v.Attempts))
+	}
+	var hookResults []string
+	for i, v := range result.HookResults {
+		status := "succeeded"
+		if v.Vetoed() {
+			status = "vetoed"
+		} else if v.Err != nil {
+			status = "failed"
+		}
+		hookResults = append(hookResults, fmt.Sprintf("- %02d: %s %s for %s (mode=%s, %s)", i+1, v.Phase, v.Name, v.NodeName, v.Mode, status))
+	}
 	var targetPreemptibleNode []string
 	if result.TargetPreemptibleNode != nil {
 		evictedPods := result.GetEvictedPodsByNodeName(result.TargetPreemptibleNode.Name)
 		targetPreemptibleNode = make([]string, 0, len(evictedPods)+1)
 		extra := fmt.Sprintf("(age=%s, pods=%02d)", shortDurationString(result.TargetPreemptibleNode.Age), len(result.TargetPreemptibleNode.Pods))
 		targetPreemptibleNode = append(targetPreemptibleNode, result.TargetPreemptibleNode.Name+" "+extra)
-		for i, v := range evictedPods {
-			targetPreemptibleNode = append(targetPreemptibleNode, fmt.Sprintf("- %02d: %s (ns=%s)", i+1, shortText(v.Name, 40), v.Namespace))
+		targetPreemptibleNode = append(targetPreemptibleNode, workloadLines(evictedPods)...)
+		if result.ReplacementNode != nil {
+			targetPreemptibleNode = append(targetPreemptibleNode, fmt.Sprintf("replaced by %s", result.ReplacementNode.Name))
 		}
 	}
 	var targetOndemandAutoscaleNode []string
-	if result.TargetOndemandAutoscaleNode != nil {
-		evictedPods := result.GetEvictedPodsByNodeName(result.TargetOndemandAutoscaleNode.Name)
-		targetOndemandAutoscaleNode = make([]string, 0, len(evictedPods)+1)
-		extra := fmt.Sprintf("(age=%s, pods=%02d)", shortDurationString(result.TargetOndemandAutoscaleNode.Age), len(result.TargetOndemandAutoscaleNode.Pods))
-		targetOndemandAutoscaleNode = append(targetOndemandAutoscaleNode, result.TargetOndemandAutoscaleNode.Name+" "+extra)
-		for i, v := range evictedPods {
-			targetOndemandAutoscaleNode = append(targetOndemandAutoscaleNode, fmt.Sprintf("- %02d: %s (ns=%s)", i+1, shortText(v.Name, 40), v.Namespace))
+	for _, node := range result.GetTargetOndemandAutoscaleNodes() {
+		evictedPods := result.GetEvictedPodsByNodeName(node.Name)
+		extra := fmt.Sprintf("(age=%s, pods=%02d)", shortDurationString(node.Age), len(node.Pods))
+		targetOndemandAutoscaleNode = append(targetOndemandAutoscaleNode, node.Name+" "+extra)
+		targetOndemandAutoscaleNode = append(targetOndemandAutoscaleNode, workloadLines(evictedPods)...)
+	}
+	var consolidation []string
+	if c := result.Consolidation; c != nil {
+		for _, v := range c.Targets {
+			consolidation = append(consolidation, fmt.Sprintf("- drain: %s (cpu=%d%%, memory=%d%%)", v.Node.Name, v.CPUUtilization, v.MemoryUtilization))
+		}
+		for _, v := range c.Skipped {
+			consolidation = append(consolidation, fmt.Sprintf("- skip: %s (cpu=%d%%, memory=%d%%) %s", v.Node.Name, v.CPUUtilization, v.MemoryUtilization, shortText(v.Reason, 60)))
 		}
 	}
+	var protectedNodes []string
+	for i, v := range result.ProtectedNodes {
+		protectedNodes = append(protectedNodes, fmt.Sprintf("- %02d: %s (policy=%s, pods=%02d)", i+1, v.Node.Name, v.Policy, len(v.Pods)))
+	}
 
 	//
 	fields := []slack.AttachmentField{
@@ -115,11 +186,48 @@ func (s *slackReporter) Report(result *Result) error {
 		},
 		{
 			Title: "Optimize end time",
-			Value: time.Now().In(timeZone).Format(time.RFC3339),
+			Value: result.Finish().EndTime().In(timeZone).Format(time.RFC3339),
 			Short: true,
 		},
 	}
 
+	if c := result.CostEstimate; c != nil {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Estimated savings",
+			Value: fmt.Sprintf("%.2f %s per %s", c.Savings, c.Currency, shortDurationString(c.Period)),
+			Short: true,
+		}, slack.AttachmentField{
+			Title: "Cumulative estimated savings",
+			Value: fmt.Sprintf("%.2f %s in %d runs", c.CumulativeSavings, c.Currency, c.CumulativeRuns),
+			Short: true,
+		})
+	}
+
+	if t := result.Trend; t != nil {
+		min, avg, max := t.OndemandNodeCountRange()
+		fields = append(fields, slack.AttachmentField{
+			Title: fmt.Sprintf("Success rate (last %d runs)", t.Runs),
+			Value: fmt.Sprintf("%.1f%%", t.SuccessRate()*100),
+			Short: true,
+		}, slack.AttachmentField{
+			Title: "Average node age at refresh",
+			Value: shortDurationString(t.AverageRefreshedNodeAge),
+			Short: true,
+		}, slack.AttachmentField{
+			Title: "On-demand nodes count",
+			Value: fmt.Sprintf("min=%d, avg=%.1f, max=%d", min, avg, max),
+			Short: true,
+		})
+	}
+
+	if result.TraceID != "" {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Trace ID",
+			Value: result.TraceID,
+			Short: true,
+		})
+	}
+
 	//
 	detailFields := make([]slack.AttachmentField, len(fields))
 	copy(detailFields, fields)
@@ -127,8 +235,14 @@ func (s *slackReporter) Report(result *Result) error {
 	//
 	detailFields = s.appendField(detailFields, "Active node pools", activeNodePoolNameLinks)
 	detailFields = s.appendField(detailFields, "Active nodes", activeNodeNameLinks)
+	detailFields = s.appendField(detailFields, "Unhealthy node pools and nodes", unhealthyMembers)
+	detailFields = s.appendField(detailFields, "Recurring failures", recurringFailures)
 	detailFields = s.appendField(detailFields, "Refresh target preemptible node", targetPreemptibleNode)
 	detailFields = s.appendField(detailFields, "Refresh target ondemand auto scale node", targetOndemandAutoscaleNode)
+	detailFields = s.appendField(detailFields, "Consolidation", consolidation)
+	detailFields = s.appendField(detailFields, "Protected nodes", protectedNodes)
+	detailFields = s.appendField(detailFields, "Unevicted pods", unevictedPods)
+	detailFields = s.appendField(detailFields, "Drain hooks", hookResults)
 
 	//
 	if message != "" {
@@ -232,3 +346,12 @@ func (s *slackReporter) WrapUserNameInLink(userName string) string {
 func (s *slackReporter) WrapTextInLink(des, link string) string {
 	return fmt.Sprintf("<%s|%s>", link, des)
 }
+
+// workloadLines returns the lines of the pods grouped by the workload.
+func workloadLines(pods []*gke.Pod) []string {
+	ret := make([]string, 0, len(pods))
+	for i, v := range gke.GroupByWorkload(pods) {
+		ret = append(ret, fmt.Sprintf("- %02d: %s (ns=%s, pods=%d)", i+1, v, v.Namespace, len(v.Pods)))
+	}
+	return ret
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"time"
+)
+
+// Trend is the summary of the recent runs read from the run history.
+type Trend struct {
+	Runs                    int
+	SucceededRuns           int
+	Since                   time.Time
+	AverageRefreshedNodeAge time.Duration
+	OndemandNodeCounts      []TrendPoint
+	RecurringFailures       []RecurringFailure
+}
+
+//
+type TrendPoint struct {
+	Time  time.Time
+	Count int
+}
+
+// RecurringFailure is the failure which occurred in two or more runs.
+type RecurringFailure struct {
+	Message  string
+	Count    int
+	LastTime time.Time
+}
+
+// SuccessRate returns the ratio of the succeeded runs between 0 and 1.
+func (t *Trend) SuccessRate() float64 {
+	if t.Runs == 0 {
+		return 0
+	}
+	return float64(t.SucceededRuns) / float64(t.Runs)
+}
+
+// OndemandNodeCountRange returns the minimum, the average and the maximum number of the on-demand nodes.
+func (t *Trend) OndemandNodeCountRange() (min int, avg float64, max int) {
+	if len(t.OndemandNodeCounts) == 0 {
+		return 0, 0, 0
+	}
+	min = t.OndemandNodeCounts[0].Count
+	sum := 0
+	for _, v := range t.OndemandNodeCounts {
+		if v.Count < min {
+			min = v.Count
+		}
+		if v.Count > max {
+			max = v.Count
+		}
+		sum += v.Count
+	}
+	return min, float64(sum) / float64(len(t.OndemandNodeCounts)), max
+}
@@ -3,10 +3,15 @@ package service
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/na-ga/gke-node-optimizer/consolidation"
+	"github.com/na-ga/gke-node-optimizer/cost"
 	"github.com/na-ga/gke-node-optimizer/gke"
 	"github.com/na-ga/gke-node-optimizer/log"
 	"github.com/na-ga/gke-node-optimizer/report"
+	"github.com/na-ga/gke-node-optimizer/tracing"
 
 	"google.golang.org/genproto/googleapis/container/v1"
 )
@@ -24,6 +29,27 @@ type (
 		MinimumPreemptibleNodeCount   int
 		OptimizePreemptibleNode       bool
 		OptimizeAutoscaleOndemandNode bool
+		HealthGate                    HealthGateOption
+		// Consolidation drains the underutilized on-demand nodes instead of the node with the fewest pods if MaxNodes is positive.
+		Consolidation consolidation.Option
+		// CheckPreemptibleCapacity skips the drain of the on-demand node whose pods cannot be absorbed by the preemptible node pools.
+		CheckPreemptibleCapacity bool
+		// Disruption skips or penalizes the nodes running the jobs and the pods annotated not to be disrupted in the selection.
+		Disruption gke.DisruptionOption
+		// ReplacementTimeout is the maximum time to wait for the replacement of the refreshed preemptible node. No wait if 0.
+		ReplacementTimeout time.Duration
+		// Estimator estimates the savings of the run. No estimate if nil.
+		Estimator *cost.Estimator
+		// DryRun is true if the optimizer only selects the targets without refreshing them.
+		DryRun bool
+	}
+
+	// HealthGateOption is the tolerance of unhealthy members. Any unhealthy member blocks the run by default.
+	HealthGateOption struct {
+		MaxNotReadyNodes             int
+		MaxNotReadyNodePercent       int
+		MaxNotRunningNodePools       int
+		MaxNotRunningNodePoolPercent int
 	}
 )
 
@@ -37,7 +63,18 @@ func NewOptimizer(client gke.Client, result *report.Result, option OptimizerOpti
 }
 
 //
-func (o *Optimizer) Optimize(ctx context.Context) error {
+func (o *Optimizer) Optimize(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "Optimize")
+	defer func() { tracing.End(span, err) }()
+	if traceID, spanID := tracing.IDs(ctx); traceID != "" {
+		o.result.TraceID = traceID
+		log.SetTrace(o.result.ProjectID(), traceID, spanID)
+	}
+
+	// Sync cache
+	if err := o.client.Sync(ctx); err != nil {
+		return fmt.Errorf("failed to sync cache: %s", err)
+	}
 
 	// Check cluster
 	cluster, err := o.client.GetCluster(ctx)
@@ -49,19 +86,51 @@ func (o *Optimizer) Optimize(ctx context.Context) error {
 		return fmt.Errorf("cluster status is not running: %s", cluster.Status.String())
 	}
 
+	// Check in-progress operations, which conflict with draining nodes
+	operations, err := o.client.GetRunningOperationList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get running operation list: %s", err)
+	}
+	if len(operations) > 0 {
+		o.result.RunningOperations = operations
+		o.result.DeferredReason = fmt.Sprintf("detected in-progress gke operations: %s", operationNames(operations))
+		log.Warnf("Defer optimization: %s", o.result.DeferredReason)
+		return nil
+	}
+	for _, v := range cluster.NodePool {
+		switch v.Status {
+		case container.NodePool_PROVISIONING, container.NodePool_RECONCILING, container.NodePool_STOPPING:
+			o.result.DeferredReason = fmt.Sprintf("detected node pool in transition: name=%s, status=%s, version=%s, maxSurge=%d, maxUnavailable=%d, message=%s",
+				v.Name, v.Status, v.Version, v.MaxSurge, v.MaxUnavailable, v.StatusMessage)
+			log.WithFields(log.Fields{log.FieldPool: v.Name}).Warnf("Defer optimization: %s", o.result.DeferredReason)
+			return nil
+		}
+	}
+
 	// Check node pools
 	preemptibleNodePools := make([]*gke.NodePool, 0, len(cluster.NodePool))
 	ondemandAutoscaleNodePools := make([]*gke.NodePool, 0, len(cluster.NodePool))
+	notRunningNodePools := make([]*gke.NodePool, 0, len(cluster.NodePool))
 	for _, v := range cluster.NodePool {
 		if v.Status != container.NodePool_RUNNING {
-			return fmt.Errorf("detected not running node pool: name=%s, status=%s", v.Name, v.Status)
+			log.WithFields(log.Fields{log.FieldPool: v.Name}).Warnf("Detected not running node pool: name=%s, status=%s", v.Name, v.Status)
+			notRunningNodePools = append(notRunningNodePools, v)
+			continue // exclude from candidates
 		}
 		if v.Preemptible {
 			preemptibleNodePools = append(preemptibleNodePools, v)
 		} else if v.Autoscale {
 			ondemandAutoscaleNodePools = append(ondemandAutoscaleNodePools, v)
 		}
-		log.Infof("Fetch node-pool. name=%s, preemptible=%t, autoscale=%t", v.Name, v.Preemptible, v.Autoscale)
+		log.WithFields(log.Fields{log.FieldPool: v.Name}).Infof("Fetch node-pool. name=%s, preemptible=%t, autoscale=%t", v.Name, v.Preemptible, v.Autoscale)
+	}
+	if len(notRunningNodePools) > 0 {
+		gate := o.option.HealthGate
+		if exceedsTolerance(len(notRunningNodePools), len(cluster.NodePool), gate.MaxNotRunningNodePools, gate.MaxNotRunningNodePoolPercent) {
+			o.result.BlockingNodePools = notRunningNodePools
+			return fmt.Errorf("detected not running node pools over tolerance: count=%d, total=%d, names=%s", len(notRunningNodePools), len(cluster.NodePool), nodePoolNames(notRunningNodePools))
+		}
+		o.result.ToleratedNodePools = notRunningNodePools
 	}
 	if len(preemptibleNodePools) == 0 {
 		return fmt.Errorf("preemptible node pools is not exists")
@@ -77,19 +146,43 @@ func (o *Optimizer) Optimize(ctx context.Context) error {
 	}
 	o.result.ActiveNodes = nodes
 	nodesByPool := make(map[string][]*gke.Node, len(cluster.NodePool))
+	nodeCountByPool := make(map[string]int, len(cluster.NodePool)) // including not ready nodes
+	notReadyNodes := make([]*gke.Node, 0, len(nodes))
+	readyNodes := make([]*gke.Node, 0, len(nodes))
 	for _, v := range nodes {
+		nodeCountByPool[v.NodePool]++
+		if v.PreDrainTaint != "" {
+			log.WithFields(log.Fields{log.FieldNode: v.Name, log.FieldPool: v.NodePool}).Warnf("Detected leftover pre-drain taint: name=%s, taint=%s", v.Name, v.PreDrainTaint)
+			o.result.LeftoverTaintedNodes = append(o.result.LeftoverTaintedNodes, v)
+		}
 		if !v.Ready {
-			return fmt.Errorf("detected not ready node: name=%s", v.Name)
+			log.WithFields(log.Fields{log.FieldNode: v.Name, log.FieldPool: v.NodePool}).Warnf("Detected not ready node: name=%s", v.Name)
+			notReadyNodes = append(notReadyNodes, v)
+			continue // exclude from candidates
 		}
+		if !v.NotReadyAt.IsZero() {
+			log.WithFields(log.Fields{log.FieldNode: v.Name, log.FieldPool: v.NodePool}).Warnf("Detected node which was not ready since the previous run: name=%s, notReadyAt=%s", v.Name, v.NotReadyAt.Format(time.RFC3339))
+			notReadyNodes = append(notReadyNodes, v)
+			continue // unstable, exclude from candidates
+		}
+		readyNodes = append(readyNodes, v)
 		if _, ok := nodesByPool[v.NodePool]; !ok {
 			nodesByPool[v.NodePool] = make([]*gke.Node, 0, len(nodes))
 		}
 		nodesByPool[v.NodePool] = append(nodesByPool[v.NodePool], v)
-		log.Infof("Fetch node. name=%s, preemptible=%t, age=%s, pods=%d", v.Name, v.Preemptible, v.Age.String(), len(v.Pods))
+		log.WithFields(log.Fields{log.FieldNode: v.Name, log.FieldPool: v.NodePool}).Infof("Fetch node. name=%s, preemptible=%t, age=%s, pods=%d", v.Name, v.Preemptible, v.Age.String(), len(v.Pods))
+	}
+	if len(notReadyNodes) > 0 {
+		gate := o.option.HealthGate
+		if exceedsTolerance(len(notReadyNodes), len(nodes), gate.MaxNotReadyNodes, gate.MaxNotReadyNodePercent) {
+			o.result.BlockingNodes = notReadyNodes
+			return fmt.Errorf("detected not ready nodes over tolerance: count=%d, total=%d, names=%s", len(notReadyNodes), len(nodes), nodeNames(notReadyNodes))
+		}
+		o.result.ToleratedNodes = notReadyNodes
 	}
 	o.result.ActiveNodePools = make([]*gke.NodePool, 0, len(cluster.NodePool))
 	for _, v := range cluster.NodePool {
-		if _, ok := nodesByPool[v.Name]; ok {
+		if nodeCountByPool[v.Name] > 0 {
 			o.result.ActiveNodePools = append(o.result.ActiveNodePools, v)
 		}
 	}
@@ -123,46 +216,215 @@ func (o *Optimizer) Optimize(ctx context.Context) error {
 	// Select target preemptible node
 	targetNodeNames := make([]string, 0, 2)
 	var oldestPreemptibleNode *gke.Node
-	for _, node := range preemptibleNodes {
-		if oldestPreemptibleNode == nil || oldestPreemptibleNode.Age < node.Age {
-			oldestPreemptibleNode = node // Choose the node with the longest uptime
+	for _, candidates := range o.protect(preemptibleNodes) {
+		for _, node := range candidates {
+			if oldestPreemptibleNode == nil || oldestPreemptibleNode.Age < node.Age {
+				oldestPreemptibleNode = node // Choose the node with the longest uptime
+			}
+		}
+		if oldestPreemptibleNode != nil {
+			break // Choose the penalized node only if no other node
 		}
 	}
 	if oldestPreemptibleNode != nil {
-		log.Infof("Refresh oldest preemptive node: name=%s, nodePoolName=%s, age=%s", oldestPreemptibleNode.Name, oldestPreemptibleNode.NodePool, oldestPreemptibleNode.Age)
+		log.WithFields(log.Fields{log.FieldNode: oldestPreemptibleNode.Name, log.FieldPool: oldestPreemptibleNode.NodePool}).Infof("Refresh oldest preemptive node: name=%s, nodePoolName=%s, age=%s", oldestPreemptibleNode.Name, oldestPreemptibleNode.NodePool, oldestPreemptibleNode.Age)
 		o.result.TargetPreemptibleNode = oldestPreemptibleNode
 		if o.option.OptimizePreemptibleNode {
 			targetNodeNames = append(targetNodeNames, oldestPreemptibleNode.Name)
 		}
 	}
 
-	// Check target ondemand auto scale node
-	var targetOndemandAutoscaleNode *gke.Node
-	for _, node := range ondemandAutoscaleNodes {
-		if targetOndemandAutoscaleNode == nil || len(targetOndemandAutoscaleNode.Pods) > len(node.Pods) {
-			targetOndemandAutoscaleNode = node // Choose the node with the fewest pods
+	// Check target ondemand auto scale nodes
+	var targetOndemandAutoscaleNodes []*gke.Node
+	ondemandAutoscaleCandidates := o.protect(ondemandAutoscaleNodes)
+	if o.option.Consolidation.MaxNodes > 0 {
+		targetOndemandAutoscaleNodes = o.consolidate(ondemandAutoscaleCandidates, readyNodes, targetNodeNames)
+	} else {
+		var targetOndemandAutoscaleNode *gke.Node
+		for _, candidates := range ondemandAutoscaleCandidates {
+			for _, node := range candidates {
+				if targetOndemandAutoscaleNode == nil || len(targetOndemandAutoscaleNode.Pods) > len(node.Pods) {
+					targetOndemandAutoscaleNode = node // Choose the node with the fewest pods
+				}
+			}
+			if targetOndemandAutoscaleNode != nil {
+				break // Choose the penalized node only if no other node
+			}
+		}
+		if targetOndemandAutoscaleNode != nil {
+			targetOndemandAutoscaleNodes = []*gke.Node{targetOndemandAutoscaleNode}
 		}
 	}
-	if targetOndemandAutoscaleNode != nil {
-		log.Infof("Refresh target ondemand auto scale node: name=%s, nodePoolName=%s, age=%s", targetOndemandAutoscaleNode.Name, targetOndemandAutoscaleNode.NodePool, targetOndemandAutoscaleNode.Age)
-		o.result.TargetOndemandAutoscaleNode = targetOndemandAutoscaleNode
+	if o.option.CheckPreemptibleCapacity && len(targetOndemandAutoscaleNodes) > 0 {
+		targetOndemandAutoscaleNodes = o.checkPreemptibleCapacity(targetOndemandAutoscaleNodes, preemptibleNodePools, nodesByPool, nodeCountByPool, targetNodeNames)
+	}
+	for _, node := range targetOndemandAutoscaleNodes {
+		log.WithFields(log.Fields{log.FieldNode: node.Name, log.FieldPool: node.NodePool}).Infof("Refresh target ondemand auto scale node: name=%s, nodePoolName=%s, age=%s", node.Name, node.NodePool, node.Age)
 		if o.option.OptimizeAutoscaleOndemandNode {
-			targetNodeNames = append(targetNodeNames, targetOndemandAutoscaleNode.Name)
+			targetNodeNames = append(targetNodeNames, node.Name)
 		}
 	}
+	if len(targetOndemandAutoscaleNodes) > 0 {
+		o.result.TargetOndemandAutoscaleNode = targetOndemandAutoscaleNodes[0]
+	}
 
 	// Refresh target nodes
 	if len(targetNodeNames) == 0 {
 		log.Info("Refresh target node does not exist")
+		o.estimate(cluster.NodePool, nodes, nil)
 		return nil
 	}
-	evictedPods, err := o.client.RefreshNodes(ctx, targetNodeNames)
-	o.result.EvictedPods = evictedPods // update evicted pods
+	if o.option.DryRun {
+		log.Infof("Skip refresh nodes in dry run: %s", strings.Join(targetNodeNames, ","))
+		return nil
+	}
+	refreshTime := time.Now()
+	evictions, err := o.client.RefreshNodes(ctx, targetNodeNames)
+	o.result.Evictions = evictions // update evicted pods
+	o.result.EvictedPods = gke.EvictedPods(evictions)
 	if err != nil {
 		return fmt.Errorf("failed to refresh nodes: %s", err)
 	}
 	log.Info("Succeeded in refresh nodes")
+	if o.option.OptimizeAutoscaleOndemandNode {
+		o.estimate(cluster.NodePool, nodes, targetOndemandAutoscaleNodes)
+	} else {
+		o.estimate(cluster.NodePool, nodes, nil)
+	}
+
+	// Verify the replacement of refreshed preemptible node
+	if o.option.OptimizePreemptibleNode && oldestPreemptibleNode != nil && o.option.ReplacementTimeout > 0 {
+		pool := oldestPreemptibleNode.NodePool
+		expectedCount := len(nodesByPool[pool])
+		replacement, err := o.client.WaitForReplacementNode(ctx, pool, expectedCount, refreshTime, o.option.ReplacementTimeout)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("aborted waiting for replacement node: %s", err)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{log.FieldPool: pool}).Warnf("Capacity did not recover after refresh: %s", err)
+			o.result.ReplacementFailure = err.Error()
+			return nil
+		}
+		o.result.ReplacementNode = replacement
+		log.WithFields(log.Fields{log.FieldNode: replacement.Name, log.FieldPool: pool}).Infof("Succeeded in verify replacement node: name=%s", replacement.Name)
+	}
 
 	// Finish
 	return nil
 }
+
+// protect returns the candidate nodes in two groups, the nodes without the protected pods and the nodes penalized by the disruption policy.
+// The nodes skipped by the policy are excluded, and the protected nodes are reported.
+func (o *Optimizer) protect(nodes []*gke.Node) [2][]*gke.Node {
+	var ret [2][]*gke.Node
+	for _, v := range nodes {
+		policy, pods := o.option.Disruption.NodePolicy(v)
+		if policy != gke.DisruptionPolicyEvict {
+			log.WithFields(log.Fields{log.FieldNode: v.Name, log.FieldPool: v.NodePool}).Infof("Detected protected pods: name=%s, policy=%s, pods=%d", v.Name, policy, len(pods))
+			o.result.ProtectedNodes = append(o.result.ProtectedNodes, &report.ProtectedNode{Node: v, Policy: policy, Pods: pods})
+		}
+		switch policy {
+		case gke.DisruptionPolicySkip:
+			continue // exclude from candidates
+		case gke.DisruptionPolicyPenalize, gke.DisruptionPolicyWait:
+			ret[1] = append(ret[1], v)
+		default:
+			ret[0] = append(ret[0], v)
+		}
+	}
+	return ret
+}
+
+// consolidate plans the consolidation of the on-demand nodes, and returns the nodes to be drained.
+// The penalized candidates are planned only if the others yield no target.
+// The nodes refreshed by the other targets are excluded from the destinations of the pods.
+func (o *Optimizer) consolidate(candidates [2][]*gke.Node, nodes []*gke.Node, excluded []string) []*gke.Node {
+	plan := consolidation.NewPlanner(o.option.Consolidation).PlanWithFallback(candidates[0], candidates[1], nodes, excluded)
+	o.result.Consolidation = plan
+	for _, v := range plan.Targets {
+		log.WithFields(log.Fields{log.FieldNode: v.Node.Name, log.FieldPool: v.Node.NodePool}).Infof("Consolidate underutilized node: name=%s, cpu=%d%%, memory=%d%%, pods=%d", v.Node.Name, v.CPUUtilization, v.MemoryUtilization, len(v.Destinations))
+	}
+	for _, v := range plan.Skipped {
+		log.WithFields(log.Fields{log.FieldNode: v.Node.Name, log.FieldPool: v.Node.NodePool}).Infof("Skip consolidation of underutilized node: name=%s, cpu=%d%%, memory=%d%%, reason=%s", v.Node.Name, v.CPUUtilization, v.MemoryUtilization, v.Reason)
+	}
+	return plan.TargetNodes()
+}
+
+// checkPreemptibleCapacity returns the on-demand nodes whose pods can be absorbed by the free capacity or the scale-up of the preemptible node pools.
+// The other nodes are skipped, and the reason is reported if all nodes are skipped.
+func (o *Optimizer) checkPreemptibleCapacity(nodes []*gke.Node, nodePools []*gke.NodePool, nodesByPool map[string][]*gke.Node, nodeCountByPool map[string]int, excluded []string) []*gke.Node {
+	capacity := consolidation.NewCapacity(nodePools, nodesByPool, nodeCountByPool, excluded)
+	ret := make([]*gke.Node, 0, len(nodes))
+	reasons := make([]string, 0, len(nodes))
+	for _, v := range nodes {
+		if _, err := capacity.Absorb(v); err != nil {
+			reason := fmt.Sprintf("preemptible node pools cannot absorb pods of node %s: %s", v.Name, err)
+			log.WithFields(log.Fields{log.FieldNode: v.Name, log.FieldPool: v.NodePool}).Warnf("Skip drain of ondemand auto scale node: %s", reason)
+			if o.result.Consolidation != nil {
+				o.result.Consolidation.Skip(v.Name, reason)
+			}
+			reasons = append(reasons, reason)
+			continue
+		}
+		ret = append(ret, v)
+	}
+	if len(ret) == 0 {
+		o.result.OndemandSkippedReason = strings.Join(reasons, ", ")
+	}
+	return ret
+}
+
+// estimate sets the estimated savings to the result. The failure is only logged because the estimate is informational.
+func (o *Optimizer) estimate(nodePools []*gke.NodePool, nodes []*gke.Node, drainedOndemandNodes []*gke.Node) {
+	if o.option.Estimator == nil {
+		return
+	}
+	estimate, err := o.option.Estimator.Estimate(nodePools, nodes, drainedOndemandNodes)
+	if err != nil {
+		log.Warnf("Failed to estimate savings: %s", err)
+	}
+	if estimate != nil && len(estimate.UnknownMachineTypes) > 0 {
+		log.Warnf("Price of machine types is not found: %s", strings.Join(estimate.UnknownMachineTypes, ","))
+	}
+	o.result.CostEstimate = estimate
+}
+
+// exceedsTolerance returns true if the unhealthy count exceeds both the count and the percentage of the total.
+func exceedsTolerance(unhealthy, total, maxCount, maxPercent int) bool {
+	allowed := maxCount
+	if byPercent := total * maxPercent / 100; byPercent > allowed {
+		allowed = byPercent
+	}
+	return unhealthy > allowed
+}
+
+//
+func nodeNames(nodes []*gke.Node) string {
+	names := make([]string, 0, len(nodes))
+	for _, v := range nodes {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+//
+func operationNames(operations []*gke.Operation) string {
+	names := make([]string, 0, len(operations))
+	for _, v := range operations {
+		target := "cluster"
+		if v.NodePool != "" {
+			target = v.NodePool
+		}
+		names = append(names, fmt.Sprintf("%s(type=%s, status=%s, target=%s)", v.Name, v.Type, v.Status, target))
+	}
+	return strings.Join(names, ",")
+}
+
+//
+func nodePoolNames(nodePools []*gke.NodePool) string {
+	names := make([]string, 0, len(nodePools))
+	for _, v := range nodePools {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ",")
+}
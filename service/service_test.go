@@ -0,0 +1,35 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+)
+
+//
+func TestExceedsTolerance(t *testing.T) {
+	tests := []struct {
+		unhealthy, total, maxCount, maxPercent int
+		want                                   bool
+	}{
+		{0, 10, 0, 0, false},
+		{1, 10, 0, 0, true},
+		{1, 10, 1, 0, false},
+		{2, 10, 1, 0, true},
+		{2, 10, 0, 20, false}, // 20% of 10 is 2
+		{3, 10, 0, 20, true},
+		{2, 9, 0, 20, true}, // 20% of 9 is rounded down to 1
+		{1, 9, 0, 20, false},
+		{3, 10, 3, 20, false}, // the larger of the count and the percentage
+		{3, 20, 1, 20, false},
+		{5, 20, 1, 20, true},
+		{0, 0, 0, 50, false},
+		{1, 1, 0, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("unhealthy=%d,total=%d,count=%d,percent=%d", tt.unhealthy, tt.total, tt.maxCount, tt.maxPercent), func(t *testing.T) {
+			if got := exceedsTolerance(tt.unhealthy, tt.total, tt.maxCount, tt.maxPercent); got != tt.want {
+				t.Errorf("unexpected result: got=%t, want=%t", got, tt.want)
+			}
+		})
+	}
+}